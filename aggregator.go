@@ -0,0 +1,444 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/AkuPython/Gator/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultAggWorkers = 1
+	maxAggWorkers     = 64
+	// aggShutdownTimeout is how long in-flight fetches get to finish after
+	// SIGINT/SIGTERM before they are cancelled.
+	aggShutdownTimeout = 30 * time.Second
+	// redirectConfirmations is how many fetches in a row must be
+	// permanently redirected to the same URL before the feed is moved there.
+	redirectConfirmations = 3
+)
+
+func handlerAgg(s *state, cmd command) error {
+	if len(cmd.Args) < 1 || len(cmd.Args) > 2 {
+		return fmt.Errorf("Must provide interval (1m, 1h, etc) and optionally a concurrency level")
+	}
+	scrapeInterval, err := time.ParseDuration(cmd.Args[0])
+	if err != nil {
+		return fmt.Errorf("invalid duration: %v", err)
+	}
+	if scrapeInterval < time.Duration(30*time.Second) {
+		return fmt.Errorf("Interval too short, must be at least 30s")
+	}
+	workers := defaultAggWorkers
+	if len(cmd.Args) == 2 {
+		workers, err = strconv.Atoi(cmd.Args[1])
+		if err != nil || workers < 1 || workers > maxAggWorkers {
+			return fmt.Errorf("Concurrency must be a number between 1 and %v", maxAggWorkers)
+		}
+	}
+	opts := aggOptions{maxFailures: s.cfg.MaxFeedFailures()}
+	opts.minInterval, opts.maxInterval, err = s.cfg.FetchIntervalBounds()
+	if err != nil {
+		return err
+	}
+	log.Printf("Checking for due feeds every %s with %v workers...", scrapeInterval, workers)
+
+	// ctx is cancelled by SIGINT/SIGTERM and stops new claims; workCtx is
+	// only cancelled once in-flight fetches overrun the shutdown deadline.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	workCtx, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
+
+	var stats aggStats
+	// At most one round of ticks is buffered, so workers stuck on slow
+	// feeds skip ticks instead of queueing them up.
+	ticks := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range ticks {
+				// Keep claiming until nothing is due, so a backlog of due
+				// feeds isn't worked off one feed per tick.
+				for ctx.Err() == nil && scrapeFeeds(workCtx, s, opts, &stats) {
+				}
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(scrapeInterval)
+	defer ticker.Stop()
+
+loop:
+	for {
+		for i := 0; i < workers; i++ {
+			select {
+			case ticks <- struct{}{}:
+			default:
+			}
+		}
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-ticker.C:
+		}
+	}
+	stop()
+	close(ticks)
+
+	log.Printf("Shutting down, waiting up to %s for in-flight fetches...", aggShutdownTimeout)
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(aggShutdownTimeout):
+		log.Printf("In-flight fetches did not finish in time, cancelling them")
+		cancelWork()
+		<-done
+	}
+	log.Print(stats.summary())
+	return nil
+}
+
+// aggOptions are the aggregator settings read from the config file.
+type aggOptions struct {
+	minInterval time.Duration
+	maxInterval time.Duration
+	maxFailures int
+}
+
+// aggStats counts what the aggregator did, for the summary printed on exit.
+type aggStats struct {
+	fetched      atomic.Int64
+	notModified  atomic.Int64
+	failed       atomic.Int64
+	postsCreated atomic.Int64
+	postsUpdated atomic.Int64
+}
+
+func (a *aggStats) summary() string {
+	return fmt.Sprintf("Aggregator stopped: %v feeds fetched (%v not modified, %v failed), %v new posts, %v updated posts",
+		a.fetched.Load(), a.notModified.Load(), a.failed.Load(), a.postsCreated.Load(), a.postsUpdated.Load())
+}
+
+// scrapeFeeds claims the most overdue feed, stores its posts and schedules
+// its next fetch. The claim also leases the feed, so concurrent workers
+// never fetch the same feed. It reports whether a feed was claimed.
+func scrapeFeeds(ctx context.Context, s *state, opts aggOptions, stats *aggStats) bool {
+	feed, err := s.db.ClaimNextFeedToFetch(ctx, time.Now().UTC())
+	if errors.Is(err, sql.ErrNoRows) {
+		return false
+	}
+	if err != nil {
+		fmt.Println("Could not get next feed to fetch", err)
+		return false
+	}
+	fmt.Println("fetching feed:", feed.Name)
+	collectFeed(ctx, s, feed, opts, stats)
+	return true
+}
+
+// collectFeed fetches a claimed feed, stores its posts and schedules its
+// next fetch.
+func collectFeed(ctx context.Context, s *state, feed database.Feed, opts aggOptions, stats *aggStats) {
+	var hints fetchHints
+	defer func() {
+		scheduleFeed(context.WithoutCancel(ctx), s, feed, hints, opts)
+	}()
+
+	// The fetcher's timeouts bound each request, so a slow host only ties
+	// up the worker that claimed it.
+	resp, err := s.fetcher.fetchFeed(ctx, feed.Url, feed.Etag.String, feed.LastModified.String)
+	if err != nil {
+		if ctx.Err() != nil {
+			// Cancelled by shutdown, which says nothing about the feed.
+			log.Printf("Stopped fetching feed %s: %v", feed.Name, ctx.Err())
+			return
+		}
+		stats.failed.Add(1)
+		fmt.Printf("Couldn't collect feed %s: %v\n", feed.Name, err)
+		recordFeedFailure(context.WithoutCancel(ctx), s, feed, err, opts)
+		var statusErr *httpStatusError
+		if errors.As(err, &statusErr) {
+			hints.RetryAfter = statusErr.RetryAfter
+		}
+		return
+	}
+	stats.fetched.Add(1)
+	err = s.db.RecordFeedSuccess(ctx, database.RecordFeedSuccessParams{
+		ID:         feed.ID,
+		LastStatus: sql.NullInt32{Int32: int32(resp.StatusCode), Valid: true},
+	})
+	if err != nil {
+		log.Printf("Couldn't record fetch of feed %s: %v", feed.Name, err)
+	}
+	trackFeedRedirect(ctx, s, feed, resp.PermanentURL)
+	hints = feedHints(resp.Feed)
+	hints.MaxAge = resp.MaxAge
+	hints.RetryAfter = resp.RetryAfter
+	if resp.NotModified {
+		saveCacheHeaders(ctx, s, feed, resp)
+		stats.notModified.Add(1)
+		log.Printf("Feed %s not modified", feed.Name)
+		return
+	}
+	feedData := resp.Feed
+	err = s.db.SetFeedMetadata(ctx, database.SetFeedMetadataParams{
+		ID:          feed.ID,
+		SiteUrl:     nullString(normalizeURL(feedData.Channel.Link)),
+		Description: nullString(feedData.Channel.Description),
+		Language:    nullString(feedData.Channel.Language),
+		ImageUrl:    nullString(feedData.Channel.Image),
+		Generator:   nullString(feedData.Channel.Generator),
+	})
+	if err != nil {
+		log.Printf("Couldn't store metadata for feed %s: %v", feed.Name, err)
+	}
+	var created, updated int
+	// Only a feed whose items were all stored may be skipped by the next
+	// conditional GET, otherwise the missing items would be lost.
+	complete := true
+	for _, item := range feedData.Channel.Item {
+		if ctx.Err() != nil {
+			log.Printf("Stopped saving feed %s: %v", feed.Name, ctx.Err())
+			complete = false
+			break
+		}
+		// Truncated to the database's precision so the returned row can be
+		// compared against it to tell inserts and edits apart.
+		now := time.Now().UTC().Truncate(time.Microsecond)
+		publishedAt, publishedAtSource := itemPublishedAt(item, now)
+
+		id := uuid.New()
+		params := database.UpsertPostParams{
+			ID:        id,
+			CreatedAt: now,
+			UpdatedAt: now,
+			FeedID:    nullFeedID(feed.ID),
+			Title:     item.Title,
+			Description: sql.NullString{
+				String: item.Description,
+				Valid:  true,
+			},
+			Url:               normalizeURL(item.Link),
+			PublishedAt:       publishedAt,
+			PublishedAtSource: publishedAtSource,
+			Guid:              itemGUID(item),
+			Author:            nullString(item.Author),
+			Categories:        item.Categories,
+			Content:           nullString(item.Content),
+			CommentsUrl:       nullString(normalizeURL(item.Comments)),
+		}
+		post, err := s.db.UpsertPost(ctx, params)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Already stored and unchanged.
+			continue
+		}
+		if err != nil {
+			log.Printf("Couldn't save post: %v", err)
+			complete = false
+			continue
+		}
+		if post.ID == id && strings.TrimSpace(item.GUID) != "" {
+			post = adoptLegacyPost(ctx, s, params, post, item.Link)
+		}
+		saveEnclosures(ctx, s, post.ID, item.Enclosures)
+		if post.ID == id {
+			created++
+		} else if post.UpdatedAt.Equal(now) {
+			updated++
+		}
+	}
+	if complete {
+		saveCacheHeaders(ctx, s, feed, resp)
+	}
+	stats.postsCreated.Add(int64(created))
+	stats.postsUpdated.Add(int64(updated))
+	log.Printf("Feed %s collected, %v posts found (%v new, %v updated)", feed.Name, len(feedData.Channel.Item), created, updated)
+}
+
+// saveCacheHeaders stores the validators the next conditional GET of the
+// feed sends.
+func saveCacheHeaders(ctx context.Context, s *state, feed database.Feed, resp *feedResponse) {
+	err := s.db.SetFeedCacheHeaders(ctx, database.SetFeedCacheHeadersParams{
+		ID:           feed.ID,
+		Etag:         sql.NullString{String: resp.ETag, Valid: resp.ETag != ""},
+		LastModified: sql.NullString{String: resp.LastModified, Valid: resp.LastModified != ""},
+	})
+	if err != nil {
+		log.Printf("Couldn't store cache headers for feed %s: %v", feed.Name, err)
+	}
+}
+
+// adoptLegacyPost replaces a post that was just inserted with the copy
+// stored before guids were tracked, if there is one, so upgrading doesn't
+// duplicate posts or lose their read and starred state. It returns the post
+// that was kept.
+func adoptLegacyPost(ctx context.Context, s *state, params database.UpsertPostParams, inserted database.Post, link string) database.Post {
+	tx, err := s.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Couldn't match post %s to an older copy: %v", params.Guid, err)
+		return inserted
+	}
+	defer tx.Rollback()
+	q := s.db.WithTx(tx)
+
+	if err := q.DeletePost(ctx, inserted.ID); err != nil {
+		log.Printf("Couldn't match post %s to an older copy: %v", params.Guid, err)
+		return inserted
+	}
+	legacy, err := q.AdoptLegacyPost(ctx, database.AdoptLegacyPostParams{
+		Guid:   params.Guid,
+		FeedID: params.FeedID,
+		Url:    params.Url,
+		Link:   link,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return inserted
+	}
+	if err != nil {
+		log.Printf("Couldn't match post %s to an older copy: %v", params.Guid, err)
+		return inserted
+	}
+	post, err := q.UpsertPost(ctx, params)
+	if errors.Is(err, sql.ErrNoRows) {
+		post, err = legacy, nil
+	}
+	if err != nil {
+		log.Printf("Couldn't update older copy of post %s: %v", params.Guid, err)
+		return inserted
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Couldn't match post %s to an older copy: %v", params.Guid, err)
+		return inserted
+	}
+	return post
+}
+
+func saveEnclosures(ctx context.Context, s *state, postID uuid.UUID, enclosures []Enclosure) {
+	for _, e := range enclosures {
+		err := s.db.UpsertEnclosure(ctx, database.UpsertEnclosureParams{
+			ID:              uuid.New(),
+			CreatedAt:       time.Now().UTC(),
+			PostID:          postID,
+			Url:             e.URL,
+			MimeType:        nullString(e.Type),
+			Length:          sql.NullInt64{Int64: e.Length, Valid: e.Length > 0},
+			DurationSeconds: sql.NullInt32{Int32: int32(e.Duration), Valid: e.Duration > 0},
+		})
+		if err != nil {
+			log.Printf("Couldn't save enclosure %s: %v", e.URL, err)
+		}
+	}
+}
+
+// nullFeedID wraps a feed ID for posts.feed_id, which is nullable because
+// starred posts are kept when their feed is deleted.
+func nullFeedID(id uuid.UUID) uuid.NullUUID {
+	return uuid.NullUUID{UUID: id, Valid: true}
+}
+
+// nullString stores empty strings as NULL.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// recordFeedFailure stores the failed fetch on the feed and disables it once
+// it has failed opts.maxFailures times in a row.
+func recordFeedFailure(ctx context.Context, s *state, feed database.Feed, fetchErr error, opts aggOptions) {
+	status := sql.NullInt32{}
+	var statusErr *httpStatusError
+	if errors.As(fetchErr, &statusErr) {
+		status = sql.NullInt32{Int32: int32(statusErr.StatusCode), Valid: true}
+	}
+	failures, err := s.db.RecordFeedFailure(ctx, database.RecordFeedFailureParams{
+		ID:         feed.ID,
+		LastStatus: status,
+		LastError:  sql.NullString{String: fetchErr.Error(), Valid: true},
+	})
+	if err != nil {
+		log.Printf("Couldn't record failure of feed %s: %v", feed.Name, err)
+		return
+	}
+	if int(failures) < opts.maxFailures {
+		return
+	}
+	if err := s.db.DisableFeed(ctx, feed.ID); err != nil {
+		log.Printf("Couldn't disable feed %s: %v", feed.Name, err)
+		return
+	}
+	log.Printf("Feed %s disabled after %v consecutive failures", feed.Name, failures)
+}
+
+// trackFeedRedirect counts fetches that were permanently redirected to
+// location and moves the feed there once the redirect has been seen
+// redirectConfirmations times in a row. The old URL stays as an alias.
+func trackFeedRedirect(ctx context.Context, s *state, feed database.Feed, location string) {
+	if location == "" {
+		if feed.RedirectUrl.Valid {
+			if err := s.db.ClearFeedRedirect(ctx, feed.ID); err != nil {
+				log.Printf("Couldn't clear redirect of feed %s: %v", feed.Name, err)
+			}
+		}
+		return
+	}
+	seen, err := s.db.RecordFeedRedirect(ctx, database.RecordFeedRedirectParams{
+		ID:          feed.ID,
+		RedirectUrl: sql.NullString{String: location, Valid: true},
+	})
+	if err != nil {
+		log.Printf("Couldn't record redirect of feed %s: %v", feed.Name, err)
+		return
+	}
+	if seen < redirectConfirmations {
+		log.Printf("Feed %s permanently redirects to %s (%v/%v)", feed.Name, location, seen, redirectConfirmations)
+		return
+	}
+	err = s.db.MoveFeedURL(ctx, database.MoveFeedURLParams{
+		ID:           feed.ID,
+		Url:          normalizeURL(location),
+		CanonicalUrl: sql.NullString{String: canonicalURL(location), Valid: true},
+	})
+	if err != nil {
+		log.Printf("Couldn't move feed %s to %s: %v", feed.Name, location, err)
+		return
+	}
+	log.Printf("Feed %s moved from %s to %s", feed.Name, feed.Url, location)
+}
+
+func scheduleFeed(ctx context.Context, s *state, feed database.Feed, hints fetchHints, opts aggOptions) {
+	postTimes, err := s.db.GetRecentPostTimesForFeed(ctx, database.GetRecentPostTimesForFeedParams{
+		FeedID: nullFeedID(feed.ID),
+		Limit:  recentPostSample,
+	})
+	if err != nil {
+		log.Printf("Couldn't get recent posts for feed %s: %v", feed.Name, err)
+	}
+	next := nextFetchAt(time.Now().UTC(), postTimes, hints, opts.minInterval, opts.maxInterval)
+	err = s.db.SetFeedNextFetch(ctx, database.SetFeedNextFetchParams{
+		ID:          feed.ID,
+		NextFetchAt: sql.NullTime{Time: next, Valid: true},
+	})
+	if err != nil {
+		log.Printf("Couldn't schedule feed %s: %v", feed.Name, err)
+		return
+	}
+	log.Printf("Feed %s next fetch at %s", feed.Name, next.Format(time.RFC3339))
+}
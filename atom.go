@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+type AtomFeed struct {
+	Title     atomText     `xml:"title"`
+	Subtitle  atomText     `xml:"subtitle"`
+	Lang      string       `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+	Generator string       `xml:"generator"`
+	Icon      string       `xml:"icon"`
+	Logo      string       `xml:"logo"`
+	Author    []AtomPerson `xml:"author"`
+	Link      []AtomLink   `xml:"link"`
+	Entry     []AtomEntry  `xml:"entry"`
+}
+
+type AtomEntry struct {
+	ID         string         `xml:"id"`
+	Title      atomText       `xml:"title"`
+	Link       []AtomLink     `xml:"link"`
+	Summary    atomText       `xml:"summary"`
+	Content    atomText       `xml:"content"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Author     []AtomPerson   `xml:"author"`
+	Category   []AtomCategory `xml:"category"`
+	MediaGroup []mediaGroup   `xml:"http://search.yahoo.com/mrss/ group"`
+}
+
+// atomText is a text construct: plain text, escaped HTML or, for
+// type="xhtml", markup nested in a <div>, which a plain string field would
+// drop.
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+// html returns the construct's content as text or HTML.
+func (t atomText) html() string {
+	if t.Type != "xhtml" {
+		return strings.TrimSpace(t.Text)
+	}
+	// The wrapping <div> is not part of the content.
+	inner := strings.TrimSpace(t.Inner)
+	start, end := strings.Index(inner, ">"), strings.LastIndex(inner, "</")
+	if start < 0 || end <= start || strings.HasSuffix(inner[:start+1], "/>") {
+		return ""
+	}
+	return strings.TrimSpace(inner[start+1 : end])
+}
+
+// text returns the construct's content without any xhtml markup, for
+// titles.
+func (t atomText) text() string {
+	if t.Type != "xhtml" {
+		return strings.TrimSpace(t.Text)
+	}
+	var b strings.Builder
+	decoder := xml.NewDecoder(strings.NewReader(t.Inner))
+	decoder.Strict = false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		if data, ok := token.(xml.CharData); ok {
+			b.Write(data)
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+type AtomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+type AtomPerson struct {
+	Name string `xml:"name"`
+}
+
+type AtomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+func parseAtom(data []byte) (*RSSFeed, error) {
+	var atom AtomFeed
+	if err := newXMLDecoder(data).Decode(&atom); err != nil {
+		return nil, fmt.Errorf("Could not Unmarshal Atom: %v", err)
+	}
+
+	var feed RSSFeed
+	feed.Format = "Atom 1.0"
+	feed.Channel.Title = atom.Title.text()
+	feed.Channel.Link = alternateLink(atom.Link)
+	feed.Channel.Description = atom.Subtitle.text()
+	feed.Channel.Language = strings.TrimSpace(atom.Lang)
+	feed.Channel.Generator = strings.TrimSpace(atom.Generator)
+	feed.Channel.Image = strings.TrimSpace(atom.Logo)
+	if feed.Channel.Image == "" {
+		feed.Channel.Image = strings.TrimSpace(atom.Icon)
+	}
+
+	for _, entry := range atom.Entry {
+		description := entry.Summary.html()
+		if description == "" {
+			description = entry.Content.html()
+		}
+		if description == "" {
+			description = rssMedia{MediaGroup: entry.MediaGroup}.summary()
+		}
+		// Entries without an author inherit the feed's.
+		authors := entry.Author
+		if len(authors) == 0 {
+			authors = atom.Author
+		}
+		var categories []string
+		for _, category := range entry.Category {
+			if category.Label != "" {
+				categories = append(categories, category.Label)
+			} else {
+				categories = append(categories, category.Term)
+			}
+		}
+		feed.Channel.Item = append(feed.Channel.Item, RSSItem{
+			Title:       entry.Title.text(),
+			Link:        alternateLink(entry.Link),
+			Description: strings.TrimSpace(description),
+			PubDate:     strings.TrimSpace(entry.Published),
+			Updated:     strings.TrimSpace(entry.Updated),
+			GUID:        strings.TrimSpace(entry.ID),
+			Author:      atomAuthors(authors),
+			Categories:  categories,
+			Content:     entry.Content.html(),
+			Comments:    repliesLink(entry.Link),
+			Enclosures:  atomEnclosures(entry),
+		})
+	}
+	return &feed, nil
+}
+
+func atomAuthors(authors []AtomPerson) string {
+	var names []string
+	for _, author := range authors {
+		if name := strings.TrimSpace(author.Name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// atomEnclosures collects rel="enclosure" links and Media RSS groups.
+func atomEnclosures(entry AtomEntry) []Enclosure {
+	var enclosures []Enclosure
+	for _, link := range entry.Link {
+		if link.Rel == "enclosure" {
+			enclosures = append(enclosures, Enclosure{URL: link.Href, Type: link.Type, Length: parseLength(link.Length)})
+		}
+	}
+	return append(enclosures, rssMedia{MediaGroup: entry.MediaGroup}.enclosures()...)
+}
+
+// repliesLink returns the rel="replies" link to an entry's comments page,
+// skipping comment feeds.
+func repliesLink(links []AtomLink) string {
+	for _, link := range links {
+		if link.Rel == "replies" && (link.Type == "" || link.Type == "text/html") {
+			return link.Href
+		}
+	}
+	return ""
+}
+
+// alternateLink returns the rel="alternate" href, which is also the
+// default when rel is omitted; otherwise the first link present.
+func alternateLink(links []AtomLink) string {
+	for _, link := range links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			return link.Href
+		}
+	}
+	if len(links) > 0 {
+		return links[0].Href
+	}
+	return ""
+}
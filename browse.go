@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/AkuPython/Gator/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	browseUsage = "Usage: browse [limit] [--all | --read] [--feed <feed>] [--since <date>] [--until <date>] " +
+		"[--search <text>] [--author <name>] [--sort published|fetched|feed] [--order asc|desc] " +
+		"[--page <n> | --offset <n>] [--after <cursor>]"
+	defaultBrowseLimit = 2
+)
+
+// browseParams turns browse's arguments into a GetPostsForUser query. All
+// filtering and sorting happens in SQL.
+func browseParams(ctx context.Context, s *state, user database.User, cmd command) (database.GetPostsForUserParams, error) {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	all := fs.Bool("all", false, "include posts already marked as read")
+	read := fs.Bool("read", false, "only show posts already marked as read")
+	feedRef := fs.String("feed", "", "only show posts of this feed (URL or name)")
+	since := fs.String("since", "", "only show posts published at or after this date")
+	until := fs.String("until", "", "only show posts published before this date")
+	search := fs.String("search", "", "only show posts with this text in their title or description")
+	author := fs.String("author", "", "only show posts whose author contains this text")
+	sortBy := fs.String("sort", "published", "sort by published date, fetched date or feed name")
+	order := fs.String("order", "desc", "sort ascending (asc) or descending (desc)")
+	page := fs.Int("page", 0, "show this page of [limit] posts, starting at 1")
+	offset := fs.Int("offset", 0, "skip this many posts")
+	after := fs.String("after", "", "continue after the cursor printed by a previous browse")
+	args, err := parseFlags(fs, cmd.Args)
+	if err != nil {
+		return database.GetPostsForUserParams{}, err
+	}
+
+	params := database.GetPostsForUserParams{
+		UserID:    user.ID,
+		ReadState: "unread",
+		SortBy:    *sortBy,
+		SortDesc:  *order == "desc",
+		PostLimit: defaultBrowseLimit,
+	}
+	if len(args) == 1 {
+		limit, err := strconv.Atoi(args[0])
+		if err != nil || limit <= 0 {
+			return params, fmt.Errorf("invalid limit: %v", args[0])
+		}
+		params.PostLimit = int32(limit)
+	} else if len(args) > 1 {
+		return params, errors.New(browseUsage)
+	}
+
+	switch {
+	case *all && *read:
+		return params, fmt.Errorf("--all and --read can't be used together")
+	case *all:
+		params.ReadState = "all"
+	case *read:
+		params.ReadState = "read"
+	}
+	if *sortBy != "published" && *sortBy != "fetched" && *sortBy != "feed" {
+		return params, fmt.Errorf("Invalid sort %v, expected published, fetched or feed", *sortBy)
+	}
+	if *order != "asc" && *order != "desc" {
+		return params, fmt.Errorf("Invalid order %v, expected asc or desc", *order)
+	}
+
+	if *feedRef != "" {
+		feed, err := lookupFeed(ctx, s, *feedRef)
+		if err != nil {
+			return params, err
+		}
+		params.FeedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+	}
+	if *since != "" {
+		date, err := parseDateArg(*since)
+		if err != nil {
+			return params, err
+		}
+		params.Since = sql.NullTime{Time: date, Valid: true}
+	}
+	if *until != "" {
+		date, err := parseDateArg(*until)
+		if err != nil {
+			return params, err
+		}
+		params.Until = sql.NullTime{Time: date, Valid: true}
+	}
+	if *search != "" {
+		params.Keyword = sql.NullString{String: escapeLike(*search), Valid: true}
+	}
+	if *author != "" {
+		params.Author = sql.NullString{String: escapeLike(*author), Valid: true}
+	}
+
+	switch {
+	case *page != 0 && *offset != 0:
+		return params, fmt.Errorf("--page and --offset can't be used together")
+	case *page < 0 || *offset < 0:
+		return params, fmt.Errorf("--page and --offset must be positive")
+	case *page > 0:
+		params.PostOffset = int32(*page-1) * params.PostLimit
+	default:
+		params.PostOffset = int32(*offset)
+	}
+	if *after != "" {
+		if *sortBy == "feed" {
+			return params, fmt.Errorf("--after can't be used when sorting by feed, use --page or --offset")
+		}
+		cursor, err := parsePostCursor(*after)
+		if err != nil {
+			return params, err
+		}
+		if cursor.Sort != browseSort(params) {
+			return params, fmt.Errorf("Cursor %v is for --sort/--order %v, not %v", *after, cursor.Sort, browseSort(params))
+		}
+		params.CursorSortKey, params.CursorID = cursor.params()
+	}
+	return params, nil
+}
+
+// browseSort names the order of a listing, as recorded in its cursors.
+func browseSort(params database.GetPostsForUserParams) string {
+	if params.SortDesc {
+		return params.SortBy + "-desc"
+	}
+	return params.SortBy + "-asc"
+}
+
+// nextBrowsePage describes how to continue a full page of posts: a cursor
+// after its last post, or an offset when sorting by feed.
+func nextBrowsePage(params database.GetPostsForUserParams, posts []database.GetPostsForUserRow) string {
+	if params.SortBy == "feed" {
+		return fmt.Sprintf("--offset %d", params.PostOffset+int32(len(posts)))
+	}
+	last := posts[len(posts)-1]
+	cursor := postCursor{Sort: browseSort(params), SortKey: last.PublishedAt, ID: last.ID}
+	if params.SortBy == "fetched" {
+		cursor.SortKey = last.CreatedAt
+	}
+	return "--after " + cursor.String()
+}
+
+// escapeLike makes s match literally inside an ILIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
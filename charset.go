@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// windows1252High maps bytes 0x80-0x9F, where windows-1252 differs from
+// ISO-8859-1; the five undefined bytes pass through as C1 controls.
+var windows1252High = [32]rune{
+	'€', '\u0081', '‚', 'ƒ', '„', '…', '†', '‡',
+	'ˆ', '‰', 'Š', '‹', 'Œ', '\u008D', 'Ž', '\u008F',
+	'\u0090', '‘', '’', '“', '”', '•', '–', '—',
+	'˜', '™', 'š', '›', 'œ', '\u009D', 'ž', 'Ÿ',
+}
+
+// iso885915 holds the eight code points where ISO-8859-15 differs from
+// ISO-8859-1.
+var iso885915 = map[byte]rune{
+	0xA4: '€', 0xA6: 'Š', 0xA8: 'š', 0xB4: 'Ž',
+	0xB8: 'ž', 0xBC: 'Œ', 0xBD: 'œ', 0xBE: 'Ÿ',
+}
+
+var xmlEncodingDecl = regexp.MustCompile(`^<\?xml[^>]*\bencoding\s*=\s*["']([A-Za-z0-9._:-]+)["']`)
+
+// decodeBody transcodes a feed body to UTF-8. The charset comes from the
+// Content-Type header, which takes precedence, or else from the XML
+// declaration. Servers often add a default charset=utf-8 to feeds in other
+// encodings, so when the body doesn't decode as the header says, the
+// declaration gets a try before giving up.
+func decodeBody(data []byte, contentType string) ([]byte, error) {
+	data = bytes.TrimPrefix(data, utf8BOM)
+	headerLabel, declLabel := "", ""
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		headerLabel = params["charset"]
+	}
+	if m := xmlEncodingDecl.FindSubmatch(bytes.TrimLeft(data, " \t\r\n")); m != nil {
+		declLabel = string(m[1])
+	}
+	if headerLabel == "" {
+		return transcode(data, declLabel)
+	}
+	decoded, err := transcode(data, headerLabel)
+	if err != nil && declLabel != "" && !strings.EqualFold(declLabel, headerLabel) {
+		if decoded, declErr := transcode(data, declLabel); declErr == nil {
+			return decoded, nil
+		}
+	}
+	return decoded, err
+}
+
+func transcode(data []byte, label string) ([]byte, error) {
+	var high func(b byte) rune
+	switch strings.ToLower(strings.Trim(strings.TrimSpace(label), `"'`)) {
+	case "":
+		if utf8.Valid(data) {
+			return data, nil
+		}
+		// Undeclared and not UTF-8: windows-1252 is by far the likeliest.
+		return transcode(data, "windows-1252")
+	case "utf-8", "utf8", "us-ascii", "ascii":
+		if !utf8.Valid(data) {
+			return nil, fmt.Errorf("Feed declares %v but is not valid UTF-8", label)
+		}
+		return data, nil
+	// Publishers labelling feeds ISO-8859-1 routinely send windows-1252
+	// smart quotes, so, like browsers, decode those labels as windows-1252.
+	case "iso-8859-1", "iso8859-1", "iso_8859-1", "latin1", "latin-1", "l1", "cp819",
+		"windows-1252", "cp1252", "x-cp1252":
+		high = func(b byte) rune {
+			if b >= 0x80 && b <= 0x9F {
+				return windows1252High[b-0x80]
+			}
+			return rune(b)
+		}
+	case "iso-8859-15", "iso8859-15", "iso_8859-15", "latin9", "latin-9", "l9":
+		high = func(b byte) rune {
+			if r, ok := iso885915[b]; ok {
+				return r
+			}
+			return rune(b)
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported charset: %v", label)
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(data) + len(data)/8)
+	for _, b := range data {
+		if b < 0x80 {
+			buf.WriteByte(b)
+		} else {
+			buf.WriteRune(high(b))
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// newXMLDecoder returns a decoder for a body decodeBody has already
+// transcoded to UTF-8, so whatever encoding its XML declaration names is
+// read as-is.
+func newXMLDecoder(data []byte) *xml.Decoder {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	return decoder
+}
@@ -0,0 +1,64 @@
+package main
+
+import "testing"
+
+func TestTranscode(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		label   string
+		want    string
+		wantErr bool
+	}{
+		{"utf-8", "café", "UTF-8", "café", false},
+		{"quoted label", "café", `"utf-8"`, "café", false},
+		{"invalid utf-8", "caf\xe9", "utf-8", "", true},
+		{"latin1", "caf\xe9", "ISO-8859-1", "café", false},
+		{"latin1 smart quotes", "\x93hi\x94", "iso-8859-1", "“hi”", false},
+		{"windows-1252 euro", "\x80 5", "windows-1252", "€ 5", false},
+		{"latin9 euro", "\xa4 5", "ISO-8859-15", "€ 5", false},
+		{"undeclared utf-8", "café", "", "café", false},
+		{"undeclared legacy", "caf\xe9", "", "café", false},
+		{"unsupported", "abc", "shift_jis", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := transcode([]byte(tt.data), tt.label)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("transcode(%q, %q) error = %v, wantErr %v", tt.data, tt.label, err, tt.wantErr)
+			}
+			if !tt.wantErr && string(got) != tt.want {
+				t.Errorf("transcode(%q, %q) = %q, want %q", tt.data, tt.label, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeBody(t *testing.T) {
+	const latin1Decl = `<?xml version="1.0" encoding="ISO-8859-1"?>`
+	const utf8Decl = `<?xml version="1.0" encoding="utf-8"?>`
+	tests := []struct {
+		name        string
+		data        string
+		contentType string
+		want        string
+		wantErr     bool
+	}{
+		{"declaration only", latin1Decl + "<rss>caf\xe9</rss>", "application/rss+xml", latin1Decl + "<rss>café</rss>", false},
+		{"header wins", utf8Decl + "<rss>caf\xe9</rss>", "text/xml; charset=iso-8859-1", utf8Decl + "<rss>café</rss>", false},
+		{"wrong default header", latin1Decl + "<rss>caf\xe9</rss>", "text/xml; charset=utf-8", latin1Decl + "<rss>café</rss>", false},
+		{"wrong header, no declaration", "<rss>caf\xe9</rss>", "text/xml; charset=utf-8", "", true},
+		{"bom", "\xef\xbb\xbf<rss>café</rss>", "text/xml", "<rss>café</rss>", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeBody([]byte(tt.data), tt.contentType)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeBody error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(got) != tt.want {
+				t.Errorf("decodeBody = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
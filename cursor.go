@@ -0,0 +1,55 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// postCursor marks a position in a post listing: the next page starts after
+// the post with this sort key and ID. Unlike an offset it doesn't shift when
+// new posts are stored. Sort records the order the listing used, such as
+// "published-desc", as the cursor means nothing in any other order.
+type postCursor struct {
+	Sort    string
+	SortKey time.Time
+	ID      uuid.UUID
+}
+
+// String encodes the cursor as an opaque, URL-safe token.
+func (c postCursor) String() string {
+	raw := c.Sort + "|" + c.SortKey.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func parsePostCursor(token string) (postCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return postCursor{}, fmt.Errorf("Invalid cursor %v", token)
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 3 {
+		return postCursor{}, fmt.Errorf("Invalid cursor %v", token)
+	}
+	c := postCursor{Sort: parts[0]}
+	if c.SortKey, err = time.Parse(time.RFC3339Nano, parts[1]); err != nil {
+		return postCursor{}, fmt.Errorf("Invalid cursor %v: %v", token, err)
+	}
+	if c.ID, err = uuid.Parse(parts[2]); err != nil {
+		return postCursor{}, fmt.Errorf("Invalid cursor %v: %v", token, err)
+	}
+	return c, nil
+}
+
+// params returns the cursor as query arguments, which are NULL for the
+// zero cursor so the listing starts from the first post.
+func (c postCursor) params() (sql.NullTime, uuid.NullUUID) {
+	if c.ID == uuid.Nil {
+		return sql.NullTime{}, uuid.NullUUID{}
+	}
+	return sql.NullTime{Time: c.SortKey, Valid: true}, uuid.NullUUID{UUID: c.ID, Valid: true}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestPostCursorRoundTrip(t *testing.T) {
+	berlin := time.FixedZone("CET", 3600)
+	cursors := []postCursor{
+		{Sort: "published-desc", SortKey: time.Date(2024, 3, 4, 10, 30, 0, 123456000, time.UTC), ID: uuid.New()},
+		{Sort: "fetched-asc", SortKey: time.Date(2024, 3, 4, 11, 30, 0, 0, berlin), ID: uuid.New()},
+	}
+	for _, c := range cursors {
+		token := c.String()
+		got, err := parsePostCursor(token)
+		if err != nil {
+			t.Fatalf("parsePostCursor(%q): %v", token, err)
+		}
+		if got.Sort != c.Sort || !got.SortKey.Equal(c.SortKey) || got.ID != c.ID {
+			t.Errorf("parsePostCursor(%q) = %+v, want %+v", token, got, c)
+		}
+		if _, err := base64.RawURLEncoding.DecodeString(token); err != nil {
+			t.Errorf("cursor %q is not URL-safe base64: %v", token, err)
+		}
+		key, id := got.params()
+		if key != (sql.NullTime{Time: got.SortKey, Valid: true}) || id != (uuid.NullUUID{UUID: c.ID, Valid: true}) {
+			t.Errorf("params() = %v, %v, want the cursor's sort key and id", key, id)
+		}
+	}
+}
+
+func TestParsePostCursorInvalid(t *testing.T) {
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+	id := uuid.New().String()
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"empty", ""},
+		{"bad base64", "not*base64!"},
+		{"too few parts", encode("published-desc|2024-03-04T10:30:00Z")},
+		{"too many parts", encode("published-desc|2024-03-04T10:30:00Z|" + id + "|extra")},
+		{"bad time", encode("published-desc|yesterday|" + id)},
+		{"bad id", encode("published-desc|2024-03-04T10:30:00Z|not-a-uuid")},
+	}
+	for _, tt := range tests {
+		if c, err := parsePostCursor(tt.token); err == nil {
+			t.Errorf("%v: parsePostCursor(%q) = %+v, want an error", tt.name, tt.token, c)
+		}
+	}
+}
+
+func TestPostCursorZeroParams(t *testing.T) {
+	key, id := postCursor{}.params()
+	if key.Valid || id.Valid {
+		t.Errorf("zero cursor params() = %v, %v, want NULLs", key, id)
+	}
+}
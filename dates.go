@@ -0,0 +1,202 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Values stored in posts.published_at_source.
+const (
+	dateSourcePublished = "published"
+	dateSourceUpdated   = "updated"
+	dateSourceFirstSeen = "first_seen"
+)
+
+// dateLayouts are tried in order after normalizeDate has removed day
+// names, translated month names and replaced zone abbreviations with
+// numeric offsets.
+var dateLayouts = []string{
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04 -0700",
+	"2 Jan 2006 15:04:05 -07:00",
+	"2 Jan 2006 15:04 -07:00",
+	"2 Jan 06 15:04:05 -0700",
+	"2 Jan 06 15:04 -0700",
+	"2 Jan 2006 15:04:05",
+	"2 Jan 2006 15:04",
+	"2 January 2006 15:04:05 -0700",
+	"2 January 2006 15:04 -0700",
+	"2 January 2006",
+	"2 Jan 2006",
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	time.DateOnly,
+	"Jan 2 15:04:05 2006",
+	"Jan 2 15:04:05 -0700 2006",
+	"Jan 2 2006 15:04:05 -0700",
+	"Jan 2, 2006 15:04:05 -0700",
+	"Jan 2, 2006 15:04 -0700",
+	"Jan 2, 2006",
+	"January 2, 2006",
+	"2-Jan-06 15:04:05 -0700",
+	"2-Jan-2006 15:04:05 -0700",
+	"01/02/2006 15:04:05",
+	"01/02/2006",
+}
+
+// zoneOffsets maps the abbreviations publishers actually emit to fixed
+// offsets, since time.Parse records unknown abbreviations as UTC+0.
+var zoneOffsets = map[string]string{
+	"UT": "+0000", "UTC": "+0000", "GMT": "+0000", "Z": "+0000", "WET": "+0000",
+	"EST": "-0500", "EDT": "-0400", "CST": "-0600", "CDT": "-0500",
+	"MST": "-0700", "MDT": "-0600", "PST": "-0800", "PDT": "-0700",
+	"AKST": "-0900", "AKDT": "-0800", "HST": "-1000", "AST": "-0400", "ADT": "-0300",
+	"NST": "-0330", "NDT": "-0230",
+	"BST": "+0100", "IST": "+0530", "WEST": "+0100", "CET": "+0100", "CEST": "+0200",
+	"MET": "+0100", "MEST": "+0200", "EET": "+0200", "EEST": "+0300", "MSK": "+0300",
+	"SGT": "+0800", "HKT": "+0800", "AWST": "+0800", "JST": "+0900", "KST": "+0900",
+	"ACST": "+0930", "ACDT": "+1030", "AEST": "+1000", "AEDT": "+1100",
+	"NZST": "+1200", "NZDT": "+1300",
+}
+
+// monthNames translates the non-English month names seen in the wild to
+// the English abbreviations the layouts expect.
+var monthNames = map[string]string{
+	// German
+	"januar": "Jan", "jänner": "Jan", "februar": "Feb", "märz": "Mar", "maerz": "Mar",
+	"mai": "May", "juni": "Jun", "juli": "Jul", "oktober": "Oct", "okt": "Oct",
+	"dezember": "Dec", "dez": "Dec", "mär": "Mar",
+	// French
+	"janvier": "Jan", "janv": "Jan", "février": "Feb", "févr": "Feb", "fevrier": "Feb",
+	"mars": "Mar", "avril": "Apr", "avr": "Apr", "juin": "Jun", "juillet": "Jul",
+	"juil": "Jul", "août": "Aug", "aout": "Aug", "septembre": "Sep", "octobre": "Oct",
+	"novembre": "Nov", "décembre": "Dec", "decembre": "Dec", "déc": "Dec",
+	// Spanish and Portuguese
+	"enero": "Jan", "ene": "Jan", "febrero": "Feb", "marzo": "Mar", "abril": "Apr",
+	"abr": "Apr", "mayo": "May", "junio": "Jun", "julio": "Jul", "agosto": "Aug",
+	"ago": "Aug", "septiembre": "Sep", "setiembre": "Sep", "octubre": "Oct",
+	"noviembre": "Nov", "diciembre": "Dec", "dic": "Dec", "janeiro": "Jan",
+	"fevereiro": "Feb", "março": "Mar", "maio": "May", "junho": "Jun", "julho": "Jul",
+	"setembro": "Sep", "outubro": "Oct", "out": "Oct", "novembro": "Nov", "dezembro": "Dec",
+	// Italian and Dutch
+	"gennaio": "Jan", "gen": "Jan", "febbraio": "Feb", "aprile": "Apr", "maggio": "May",
+	"mag": "May", "giugno": "Jun", "giu": "Jun", "luglio": "Jul", "lug": "Jul",
+	"settembre": "Sep", "set": "Sep", "ottobre": "Oct", "ott": "Oct", "dicembre": "Dec",
+	"januari": "Jan", "februari": "Feb", "maart": "Mar", "mei": "May", "augustus": "Aug",
+	// English variants
+	"sept": "Sep",
+}
+
+// trailingZoneComment matches "(PST)" or "(Coordinated Universal Time)".
+var trailingZoneComment = regexp.MustCompile(`\s*\([^)]*\)$`)
+
+// parseDate tries the layouts publishers commonly use, reporting false
+// when none of them match.
+func parseDate(value string) (time.Time, bool) {
+	value = normalizeDate(value)
+	if value == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+func normalizeDate(value string) string {
+	value = trailingZoneComment.ReplaceAllString(strings.TrimSpace(value), "")
+	fields := strings.Fields(value)
+	// Drop a leading weekday in any language ("Mon,", "Lun.", "Dienstag,")
+	// but keep a leading month name, unless a later field is the month:
+	// "mar." is Tuesday in "mar., 03 mars 2020".
+	if len(fields) > 1 && isWord(fields[0]) && (!isMonthName(fields[0]) || hasMonthName(fields[1:])) {
+		fields = fields[1:]
+	}
+	for i, field := range fields {
+		if month, ok := monthNames[strings.ToLower(strings.TrimSuffix(field, "."))]; ok {
+			fields[i] = month
+			continue
+		}
+		if offset, ok := zoneOffsets[strings.ToUpper(field)]; ok && i > 0 {
+			fields[i] = offset
+			continue
+		}
+		// German and Scandinavian dates write the day as "3."
+		if day := strings.TrimSuffix(field, "."); day != field && isDigits(day) {
+			fields[i] = day
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+func isWord(field string) bool {
+	field = strings.TrimRight(field, ".,")
+	if field == "" {
+		return false
+	}
+	for _, r := range field {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigits(field string) bool {
+	if field == "" {
+		return false
+	}
+	for _, r := range field {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func hasMonthName(fields []string) bool {
+	for _, field := range fields {
+		if isWord(field) && isMonthName(field) {
+			return true
+		}
+	}
+	return false
+}
+
+func isMonthName(field string) bool {
+	field = strings.ToLower(strings.TrimRight(field, ".,"))
+	if _, ok := monthNames[field]; ok {
+		return true
+	}
+	for m := time.January; m <= time.December; m++ {
+		name := strings.ToLower(m.String())
+		if field == name || field == name[:3] {
+			return true
+		}
+	}
+	return false
+}
+
+// itemPublishedAt picks the item's publication date, falling back to its
+// update date and finally to the time it was first seen, and reports
+// which of those was used.
+func itemPublishedAt(item RSSItem, firstSeen time.Time) (time.Time, string) {
+	if t, ok := parseDate(item.PubDate); ok {
+		return t, dateSourcePublished
+	}
+	if t, ok := parseDate(item.Updated); ok {
+		return t, dateSourceUpdated
+	}
+	return firstSeen, dateSourceFirstSeen
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string // RFC 3339, empty when the value shouldn't parse
+	}{
+		{"Mon, 02 Jan 2006 15:04:05 +0000", "2006-01-02T15:04:05Z"},
+		{"Mon, 02 Jan 2006 15:04:05 GMT", "2006-01-02T15:04:05Z"},
+		{"Mon, 02 Jan 2006 15:04:05 EST", "2006-01-02T20:04:05Z"},
+		{"Mon, 02 Jan 2006 15:04:05 +00:00", "2006-01-02T15:04:05Z"},
+		{"Mon, 02 Jan 2006 15:04 +02:00", "2006-01-02T13:04:00Z"},
+		{"Mon, 02 Jan 2006 15:04 -0700", "2006-01-02T22:04:00Z"},
+		{"02 Jan 06 15:04:05 +0000", "2006-01-02T15:04:05Z"},
+		{"Mon, 2 Jan 2006 15:04:05 +0000 (UTC)", "2006-01-02T15:04:05Z"},
+		{"2006-01-02T15:04:05Z", "2006-01-02T15:04:05Z"},
+		{"2006-01-02T15:04:05.123+01:00", "2006-01-02T14:04:05.123Z"},
+		{"2006-01-02 15:04:05", "2006-01-02T15:04:05Z"},
+		{"2006-01-02", "2006-01-02T00:00:00Z"},
+		{"Jan 2, 2006", "2006-01-02T00:00:00Z"},
+		{"Mar 3, 2020 10:00:00 +0000", "2020-03-03T10:00:00Z"},
+		{"Dienstag, 3. März 2020 10:00:00 +0100", "2020-03-03T09:00:00Z"},
+		{"mar., 03 mars 2020 10:00:00 +0100", "2020-03-03T09:00:00Z"},
+		{"martes, 3 marzo 2020 10:00:00 +0100", "2020-03-03T09:00:00Z"},
+		{"lun. 02 janv. 2006 15:04:05 +0000", "2006-01-02T15:04:05Z"},
+		{"", ""},
+		{"not a date", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, ok := parseDate(tt.value)
+			if tt.want == "" {
+				if ok {
+					t.Errorf("parseDate(%q) = %v, want no match", tt.value, got)
+				}
+				return
+			}
+			want, err := time.Parse(time.RFC3339Nano, tt.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok || !got.Equal(want) {
+				t.Errorf("parseDate(%q) = %v, %v, want %v", tt.value, got, ok, want)
+			}
+		})
+	}
+}
+
+func TestItemPublishedAt(t *testing.T) {
+	firstSeen := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		item   RSSItem
+		source string
+	}{
+		{RSSItem{PubDate: "2006-01-02T15:04:05Z", Updated: "2007-01-02T15:04:05Z"}, dateSourcePublished},
+		{RSSItem{PubDate: "soon", Updated: "2007-01-02T15:04:05Z"}, dateSourceUpdated},
+		{RSSItem{}, dateSourceFirstSeen},
+	}
+	for _, tt := range tests {
+		got, source := itemPublishedAt(tt.item, firstSeen)
+		if source != tt.source {
+			t.Errorf("itemPublishedAt(%+v) source = %v, want %v", tt.item, source, tt.source)
+		}
+		if source == dateSourceFirstSeen && !got.Equal(firstSeen) {
+			t.Errorf("itemPublishedAt(%+v) = %v, want %v", tt.item, got, firstSeen)
+		}
+	}
+}
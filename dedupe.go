@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/AkuPython/Gator/internal/database"
+)
+
+// handlerDedupeFeeds merges feeds whose URLs share a canonical form into the
+// oldest of them, moving their follows and posts over and keeping their
+// URLs as aliases. Every feed is left with a normalized URL and its
+// canonical_url set. As it merges other users' feeds, only an admin may
+// run it.
+func handlerDedupeFeeds(s *state, cmd command, user database.User) error {
+	if len(cmd.Args) != 0 {
+		return fmt.Errorf("Unexpected arguments: %v", cmd.Args)
+	}
+	if !user.IsAdmin {
+		return fmt.Errorf("Only an admin can dedupe feeds")
+	}
+	ctx := context.Background()
+	feeds, err := s.db.GetFeeds(ctx)
+	if err != nil {
+		return fmt.Errorf("Could not get feeds from DB: %v", err)
+	}
+	sort.SliceStable(feeds, func(i, j int) bool {
+		return feeds[i].CreatedAt.Before(feeds[j].CreatedAt)
+	})
+
+	groups := map[string][]database.Feed{}
+	var keys []string
+	for _, feed := range feeds {
+		key := canonicalURL(feed.Url)
+		if groups[key] == nil {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], feed)
+	}
+
+	merged := 0
+	for _, key := range keys {
+		group := groups[key]
+		if err := mergeFeeds(ctx, s, key, group[0], group[1:]); err != nil {
+			return fmt.Errorf("Could not merge feeds for %v: %v", key, err)
+		}
+		for _, dup := range group[1:] {
+			fmt.Printf("Merged %v (%v) into %v (%v)\n", dup.Name, dup.Url, group[0].Name, group[0].Url)
+		}
+		merged += len(group) - 1
+	}
+	fmt.Printf("Merged %v duplicate feeds, %v feeds remain\n", merged, len(keys))
+	return nil
+}
+
+// mergeFeeds folds dups into keep in a single transaction.
+func mergeFeeds(ctx context.Context, s *state, canonical string, keep database.Feed, dups []database.Feed) error {
+	tx, err := s.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	q := s.db.WithTx(tx)
+
+	for _, dup := range dups {
+		err := q.MoveFeedFollows(ctx, database.MoveFeedFollowsParams{ToFeedID: keep.ID, FromFeedID: dup.ID})
+		if err != nil {
+			return fmt.Errorf("Could not move follows of %v: %v", dup.Name, err)
+		}
+		err = q.MovePosts(ctx, database.MovePostsParams{ToFeedID: nullFeedID(keep.ID), FromFeedID: nullFeedID(dup.ID)})
+		if err != nil {
+			return fmt.Errorf("Could not move posts of %v: %v", dup.Name, err)
+		}
+		err = q.MergeFeedAliases(ctx, database.MergeFeedAliasesParams{
+			ToFeedID:   keep.ID,
+			FromFeedID: dup.ID,
+			Url:        normalizeURL(dup.Url),
+		})
+		if err != nil {
+			return fmt.Errorf("Could not keep %v as an alias: %v", dup.Url, err)
+		}
+		// Whatever wasn't moved, such as posts both feeds had, goes with it
+		// unless someone starred it.
+		if _, err := q.DeleteUnstarredFeedPosts(ctx, nullFeedID(dup.ID)); err != nil {
+			return fmt.Errorf("Could not delete posts of %v: %v", dup.Name, err)
+		}
+		if err := q.DeleteFeed(ctx, dup.ID); err != nil {
+			return fmt.Errorf("Could not delete %v: %v", dup.Name, err)
+		}
+	}
+	err = q.SetFeedURL(ctx, database.SetFeedURLParams{
+		ID:           keep.ID,
+		Url:          normalizeURL(keep.Url),
+		CanonicalUrl: sql.NullString{String: canonical, Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("Could not normalize URL of %v: %v", keep.Name, err)
+	}
+	return tx.Commit()
+}
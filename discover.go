@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// feedLinkTypes are the <link rel="alternate"> types that point at feeds.
+var feedLinkTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/rdf+xml":   true,
+	"application/feed+json": true,
+	"application/json":      true,
+}
+
+// commonFeedPaths are probed, in order, when a page advertises no feeds.
+var commonFeedPaths = []string{"/feed", "/rss.xml", "/feed.xml", "/atom.xml", "/index.xml", "/rss", "/feed.json"}
+
+var (
+	htmlLinkTag = regexp.MustCompile(`(?is)<(link|base)\b[^>]*>`)
+	htmlAttr    = regexp.MustCompile(`(?is)([a-z-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+type feedCandidate struct {
+	URL   string
+	Title string
+	Type  string
+}
+
+// resolveFeedURL fetches rawURL and returns it with the response when it is
+// a feed. When it is a web page the page's feeds are discovered instead: a
+// single match is fetched and returned, several are listed in the error so
+// the user can pick one. A failed fetch still returns the URL alongside the
+// error; the URL is only empty when no feed could be picked.
+func resolveFeedURL(ctx context.Context, s *state, rawURL string) (string, *feedResponse, error) {
+	resp, err := s.fetcher.fetchFeed(ctx, rawURL, "", "")
+	var notFeed *notFeedError
+	if !errors.As(err, &notFeed) || !notFeed.HTML {
+		return rawURL, resp, err
+	}
+
+	fmt.Printf("%v is a web page, looking for its feeds...\n", rawURL)
+	candidates, err := s.fetcher.discoverFeeds(ctx, rawURL)
+	if err != nil {
+		return "", nil, err
+	}
+	feedURL, err := chooseCandidate(rawURL, candidates)
+	if err != nil {
+		return "", nil, err
+	}
+	resp, err = s.fetcher.fetchFeed(ctx, feedURL, "", "")
+	return feedURL, resp, err
+}
+
+func chooseCandidate(pageURL string, candidates []feedCandidate) (string, error) {
+	switch len(candidates) {
+	case 0:
+		return "", fmt.Errorf("No feeds found at %v", pageURL)
+	case 1:
+		fmt.Printf("Found feed: %v\n", candidates[0].URL)
+		return candidates[0].URL, nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v has %v feeds, re-run with one of:", pageURL, len(candidates))
+	for _, c := range candidates {
+		fmt.Fprintf(&b, "\n\t%v", c.URL)
+		if c.Title != "" {
+			fmt.Fprintf(&b, " (%v)", c.Title)
+		}
+	}
+	return "", errors.New(b.String())
+}
+
+// discoverFeeds finds the feeds a web page advertises with
+// <link rel="alternate">, falling back to probing common feed paths. It
+// finds nothing when pageURL is not a web page.
+func (f *fetcher) discoverFeeds(ctx context.Context, pageURL string) ([]feedCandidate, error) {
+	page, contentType, base, err := f.fetchPage(ctx, pageURL)
+	if err != nil {
+		return nil, err
+	}
+	if !isHTML(page, contentType) {
+		return nil, nil
+	}
+	if candidates := feedLinks(page, base); len(candidates) > 0 {
+		return candidates, nil
+	}
+
+	for _, path := range commonFeedPaths {
+		probe := base.ResolveReference(&url.URL{Path: path})
+		resp, err := f.fetchFeed(ctx, probe.String(), "", "")
+		if err != nil {
+			continue
+		}
+		return []feedCandidate{{URL: probe.String(), Title: resp.Feed.Channel.Title}}, nil
+	}
+	return nil, nil
+}
+
+// fetchPage downloads a web page, returning its body, its Content-Type and
+// the URL it was finally served from, which relative links resolve against.
+func (f *fetcher) fetchPage(ctx context.Context, pageURL string) ([]byte, string, *url.URL, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("Could not create Context: %v", err)
+	}
+	req.Header.Set("User-Agent", "gator")
+	req.Header.Set("Accept", "text/html, application/xhtml+xml;q=0.9, */*;q=0.5")
+	resp, err := f.get(ctx, req)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	defer resp.Body.Close()
+	body, err := f.readBody(resp)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return body, resp.Header.Get("Content-Type"), resp.Request.URL, nil
+}
+
+// feedLinks extracts <link rel="alternate"> feed links from a page,
+// honoring <base href>. Regexps are enough here and, unlike a strict
+// parser, survive the malformed markup common in the wild.
+func feedLinks(page []byte, base *url.URL) []feedCandidate {
+	var candidates []feedCandidate
+	seen := map[string]bool{}
+	for _, tag := range htmlLinkTag.FindAllSubmatch(page, -1) {
+		attrs := map[string]string{}
+		for _, attr := range htmlAttr.FindAllSubmatch(tag[0], -1) {
+			value := string(attr[2]) + string(attr[3]) + string(attr[4])
+			attrs[strings.ToLower(string(attr[1]))] = strings.TrimSpace(html.UnescapeString(value))
+		}
+		if strings.EqualFold(string(tag[1]), "base") {
+			if href, err := base.Parse(attrs["href"]); err == nil && attrs["href"] != "" {
+				base = href
+			}
+			continue
+		}
+
+		mediaType, _, _ := mime.ParseMediaType(attrs["type"])
+		if !hasToken(attrs["rel"], "alternate") || !feedLinkTypes[mediaType] || attrs["href"] == "" {
+			continue
+		}
+		href, err := base.Parse(attrs["href"])
+		if err != nil || seen[href.String()] {
+			continue
+		}
+		seen[href.String()] = true
+		candidates = append(candidates, feedCandidate{URL: href.String(), Title: attrs["title"], Type: mediaType})
+	}
+	return candidates
+}
+
+func hasToken(list, token string) bool {
+	for _, field := range strings.Fields(list) {
+		if strings.EqualFold(field, token) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestFeedLinks(t *testing.T) {
+	base, err := url.Parse("https://example.com/blog/post.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		page string
+		want []feedCandidate
+	}{
+		{
+			name: "relative href",
+			page: `<head><link rel="alternate" type="application/rss+xml" title="Posts" href="feed.xml"></head>`,
+			want: []feedCandidate{{URL: "https://example.com/blog/feed.xml", Title: "Posts", Type: "application/rss+xml"}},
+		},
+		{
+			name: "root-relative and absolute hrefs",
+			page: `<link rel="alternate" type="application/atom+xml" href="/atom.xml">
+<link rel="alternate" type="application/feed+json" href="https://feeds.example.net/site.json">`,
+			want: []feedCandidate{
+				{URL: "https://example.com/atom.xml", Type: "application/atom+xml"},
+				{URL: "https://feeds.example.net/site.json", Type: "application/feed+json"},
+			},
+		},
+		{
+			name: "base href",
+			page: `<base href="https://cdn.example.org/site/"><link rel="alternate" type="application/rss+xml" href="rss">`,
+			want: []feedCandidate{{URL: "https://cdn.example.org/site/rss", Type: "application/rss+xml"}},
+		},
+		{
+			name: "relative base href",
+			page: `<BASE HREF="/other/"><LINK REL="Alternate" TYPE="application/rss+xml" HREF="rss">`,
+			want: []feedCandidate{{URL: "https://example.com/other/rss", Type: "application/rss+xml"}},
+		},
+		{
+			name: "single-quoted and unquoted attributes",
+			page: `<link rel='alternate' type='application/atom+xml' href='a.xml' title='A &amp; B'>
+<link rel=alternate type=application/rss+xml href=/b.xml />`,
+			want: []feedCandidate{
+				{URL: "https://example.com/blog/a.xml", Title: "A & B", Type: "application/atom+xml"},
+				{URL: "https://example.com/b.xml", Type: "application/rss+xml"},
+			},
+		},
+		{
+			name: "rel with several tokens",
+			page: `<link rel="alternate home" type="application/rss+xml; charset=utf-8" href="/feed">`,
+			want: []feedCandidate{{URL: "https://example.com/feed", Type: "application/rss+xml"}},
+		},
+		{
+			name: "non-feed links",
+			page: `<link rel="stylesheet" href="/style.css">
+<link rel="alternate" type="text/html" hreflang="fr" href="/fr/">
+<link rel="alternate" href="/untyped">
+<link rel="icon" type="application/rss+xml" href="/not-alternate.xml">
+<link rel="alternate" type="application/rss+xml" href="">`,
+			want: nil,
+		},
+		{
+			name: "duplicates",
+			page: `<link rel="alternate" type="application/rss+xml" href="/feed">
+<link rel="alternate" type="application/rss+xml" href="https://example.com/feed">`,
+			want: []feedCandidate{{URL: "https://example.com/feed", Type: "application/rss+xml"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := feedLinks([]byte(tt.page), base); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("feedLinks() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/AkuPython/Gator/internal/database"
+	"github.com/google/uuid"
+)
+
+const enclosuresUsage = "Usage: enclosures download <post id>"
+
+// deletedFeedDir holds the enclosures of starred posts whose feed has been
+// removed.
+const deletedFeedDir = "Deleted feeds"
+
+// partSuffix marks a download that hasn't finished yet. It is resumed from
+// where it stopped the next time the same enclosure is downloaded.
+const partSuffix = ".part"
+
+func handlerEnclosures(s *state, cmd command) error {
+	if len(cmd.Args) != 2 || cmd.Args[0] != "download" {
+		return errors.New(enclosuresUsage)
+	}
+	postID, err := uuid.Parse(cmd.Args[1])
+	if err != nil {
+		return fmt.Errorf("Invalid post id %v: %v", cmd.Args[1], err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	enclosures, err := s.db.GetPostEnclosures(ctx, postID)
+	if err != nil {
+		return fmt.Errorf("Could not get enclosures from DB: %v", err)
+	}
+	if len(enclosures) == 0 {
+		return fmt.Errorf("Post %v has no enclosures", postID)
+	}
+	root, err := s.cfg.Downloads()
+	if err != nil {
+		return err
+	}
+	feedDir := deletedFeedDir
+	if enclosures[0].FeedName.Valid {
+		feedDir = safeFileName(enclosures[0].FeedName.String)
+	}
+	dir := filepath.Join(root, feedDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("Could not create download dir: %v", err)
+	}
+
+	for _, enclosure := range enclosures {
+		dest := filepath.Join(dir, enclosureFileName(enclosure))
+		if _, err := os.Stat(dest); err == nil {
+			fmt.Printf("Already downloaded: %v\n", dest)
+			continue
+		}
+		fmt.Printf("Downloading %v (%v)...\n", enclosure.Url, formatSize(enclosure.Length.Int64))
+		if err := s.fetcher.download(ctx, enclosure.Url, dest); err != nil {
+			return fmt.Errorf("Could not download %v: %v", enclosure.Url, err)
+		}
+		fmt.Printf("Saved %v\n", dest)
+	}
+	return nil
+}
+
+// download saves rawURL to dest through dest.part, asking the server for
+// only the missing bytes when a previous attempt left a partial file.
+func (f *fetcher) download(ctx context.Context, rawURL, dest string) error {
+	part := dest + partSuffix
+	var offset int64
+	if info, err := os.Stat(part); err == nil {
+		offset = info.Size()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "gator")
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	if err := f.limiter.wait(ctx, req.URL.Host); err != nil {
+		return err
+	}
+	resp, err := f.downloads.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)):
+		fmt.Printf("Resuming from %v\n", formatSize(offset))
+		flags |= os.O_APPEND
+	case resp.StatusCode == http.StatusOK:
+		// The server ignored the range, so start over.
+		flags |= os.O_TRUNC
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// The partial file already holds everything.
+		return os.Rename(part, dest)
+	default:
+		return &httpStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	file, err := os.OpenFile(part, flags, 0o644)
+	if err != nil {
+		return err
+	}
+	_, copyErr := io.Copy(file, resp.Body)
+	if err := file.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+	if copyErr != nil {
+		return fmt.Errorf("%v (the partial download is kept and resumed next time)", copyErr)
+	}
+	return os.Rename(part, dest)
+}
+
+// enclosureFileName names the file after the enclosure's ID and the last
+// segment of its URL path. The ID keeps enclosures whose URLs end alike, as
+// with many podcast hosts, from overwriting or resuming each other's files.
+func enclosureFileName(enclosure database.GetPostEnclosuresRow) string {
+	name := ""
+	if u, err := url.Parse(enclosure.Url); err == nil {
+		name = safeFileName(path.Base(u.Path))
+	}
+	if name == "" || name == "_" {
+		return enclosure.ID.String()
+	}
+	return enclosure.ID.String() + "-" + name
+}
+
+// safeFileName replaces path separators and other characters that are
+// awkward in file names.
+func safeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < ' ' || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	return strings.Trim(name, ". ")
+}
+
+func formatSize(bytes int64) string {
+	if bytes <= 0 {
+		return "unknown size"
+	}
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+func formatDuration(seconds int32) string {
+	return (time.Duration(seconds) * time.Second).String()
+}
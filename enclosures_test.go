@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/AkuPython/Gator/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestEnclosureFileName(t *testing.T) {
+	id := uuid.MustParse("6f1c2a4e-0d3b-4c59-9a7e-2b8f5d1e3c40")
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://cdn.example.com/show/ep1/audio.mp3", id.String() + "-audio.mp3"},
+		{"https://cdn.example.com/show/ep1/audio.mp3?token=abc", id.String() + "-audio.mp3"},
+		{"https://cdn.example.com/a%3Ab.mp3", id.String() + "-a_b.mp3"},
+		{"https://cdn.example.com/", id.String()},
+		{"https://cdn.example.com", id.String()},
+	}
+	for _, tt := range tests {
+		got := enclosureFileName(database.GetPostEnclosuresRow{ID: id, Url: tt.url})
+		if got != tt.want {
+			t.Errorf("enclosureFileName(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+
+	other := database.GetPostEnclosuresRow{ID: uuid.New(), Url: "https://cdn.example.com/show/ep2/audio.mp3"}
+	first := database.GetPostEnclosuresRow{ID: id, Url: "https://cdn.example.com/show/ep1/audio.mp3"}
+	if enclosureFileName(first) == enclosureFileName(other) {
+		t.Error("enclosures with the same URL base share a file name")
+	}
+}
@@ -1,52 +1,149 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/xml"
 	"fmt"
 	"html"
-	"io"
+	"mime"
 	"net/http"
+	"strings"
+	"time"
 )
 
 type RSSFeed struct {
+	// Format names the format the feed was parsed from, e.g. "Atom 1.0".
+	Format  string `xml:"-"`
+	Version string `xml:"version,attr"`
 	Channel struct {
-		Title       string    `xml:"title"`
-		Link        string    `xml:"link"`
-		Description string    `xml:"description"`
-		Item        []RSSItem `xml:"item"`
+		Title string `xml:"title"`
+		// Ahead of Link so <atom:link rel="self">, which many RSS feeds
+		// add after <link>, isn't mistaken for it.
+		AtomLinks []struct {
+			Href string `xml:"href,attr"`
+		} `xml:"http://www.w3.org/2005/Atom link"`
+		Link        string `xml:"link"`
+		Description string `xml:"description"`
+		Language    string `xml:"language"`
+		Generator   string `xml:"generator"`
+		// Ahead of RSSImage so <itunes:image> isn't mistaken for <image>.
+		ITunesImage struct {
+			Href string `xml:"href,attr"`
+		} `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+		RSSImage struct {
+			URL string `xml:"url"`
+		} `xml:"image"`
+		Image     string    `xml:"-"`
+		TTL       string    `xml:"ttl"`
+		SkipHours []string  `xml:"skipHours>hour"`
+		SkipDays  []string  `xml:"skipDays>day"`
+		Item      []RSSItem `xml:"item"`
 	} `xml:"channel"`
 }
 
 type RSSItem struct {
+	rssMedia
 	Title       string `xml:"title"`
 	Link        string `xml:"link"`
 	Description string `xml:"description"`
 	PubDate     string `xml:"pubDate"`
+	GUID        string `xml:"guid"`
+	Updated     string `xml:"-"`
+	Author      string `xml:"author"`
+	// Creator is RSS's usual stand-in for <author>, which must be an email
+	// address; parseFeed folds it into Author.
+	Creator    string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Categories []string `xml:"category"`
+	// Content is the full post body, where Description is often a summary.
+	Content    string      `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	Comments   string      `xml:"comments"`
+	Enclosures []Enclosure `xml:"-"`
 }
 
-func fetchFeed(ctx context.Context, feedURL string) (*RSSFeed, error) {
-	var body io.Reader
-	req, err := http.NewRequestWithContext(ctx, "GET", feedURL, body)
+// itemGUID identifies an item within its feed: the publisher's guid/id
+// when present, otherwise a hash of the link and title.
+func itemGUID(item RSSItem) string {
+	if guid := strings.TrimSpace(item.GUID); guid != "" {
+		return guid
+	}
+	sum := sha256.Sum256([]byte(item.Link + "\n" + item.Title))
+	return hex.EncodeToString(sum[:])
+}
+
+const feedAccept = "application/rss+xml, application/atom+xml, application/feed+json, application/xml;q=0.9, text/xml;q=0.9, application/json;q=0.8, */*;q=0.5"
+
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// feedResponse is the outcome of a conditional GET. When NotModified is
+// set the publisher answered 304 and Feed is nil. PermanentURL is set when
+// the feed has moved with a 301 or 308 redirect.
+type feedResponse struct {
+	Feed         *RSSFeed
+	StatusCode   int
+	NotModified  bool
+	ETag         string
+	LastModified string
+	MaxAge       time.Duration
+	RetryAfter   time.Duration
+	PermanentURL string
+}
+
+func (f *fetcher) fetchFeed(ctx context.Context, feedURL, etag, lastModified string) (*feedResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", feedURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("Could not create Context: %v", err)
 	}
-	client := &http.Client{}
 	req.Header.Set("User-Agent", "gator")
-	resp, err := client.Do(req)
+	req.Header.Set("Accept", feedAccept)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+	resp, err := f.get(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("client.Do error: %v", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	xmlBody, err := io.ReadAll(resp.Body)
+	result := &feedResponse{
+		StatusCode:   resp.StatusCode,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		MaxAge:       cacheMaxAge(resp.Header),
+		RetryAfter:   retryAfter(resp.Header, time.Now()),
+		PermanentURL: permanentLocation(resp),
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		result.NotModified = true
+		// Some servers omit the validators on a 304; keep the ones we sent.
+		if result.ETag == "" {
+			result.ETag = etag
+		}
+		if result.LastModified == "" {
+			result.LastModified = lastModified
+		}
+		return result, nil
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if err := checkContentType(contentType); err != nil {
+		return nil, err
+	}
+	body, err := f.readBody(resp)
 	if err != nil {
-		return nil, fmt.Errorf("client.Do error: %v", err)
+		return nil, err
+	}
+	if isHTML(body, contentType) && !looksLikeFeed(body, contentType) {
+		return nil, &notFeedError{ContentType: contentType, HTML: true}
 	}
-	var feed RSSFeed
-	err = xml.Unmarshal(xmlBody, &feed)
+	feed, err := parseFeed(body, contentType)
 	if err != nil {
-		return nil, fmt.Errorf("Could not Unmarshal: %v", err)
+		return nil, err
 	}
 	feed.Channel.Title = html.UnescapeString(feed.Channel.Title)
 	feed.Channel.Description = html.UnescapeString(feed.Channel.Description)
@@ -54,9 +151,137 @@ func fetchFeed(ctx context.Context, feedURL string) (*RSSFeed, error) {
 	for i, item := range feed.Channel.Item {
 		feed.Channel.Item[i].Title = html.UnescapeString(item.Title)
 		feed.Channel.Item[i].Description = html.UnescapeString(item.Description)
+		feed.Channel.Item[i].Author = html.UnescapeString(strings.TrimSpace(item.Author))
+		feed.Channel.Item[i].Comments = strings.TrimSpace(item.Comments)
+		feed.Channel.Item[i].Categories = cleanCategories(item.Categories)
 	}
 	// fmt.Println(feed)
-	return &feed, nil
+	result.Feed = feed
+	return result, nil
 }
 
+// cleanCategories trims categories and drops empty and repeated ones.
+func cleanCategories(categories []string) []string {
+	cleaned := []string{}
+	seen := map[string]bool{}
+	for _, category := range categories {
+		category = html.UnescapeString(strings.TrimSpace(category))
+		if category == "" || seen[category] {
+			continue
+		}
+		seen[category] = true
+		cleaned = append(cleaned, category)
+	}
+	return cleaned
+}
 
+// parseFeed detects the feed format from the Content-Type header, falling
+// back to sniffing the body, and returns the items normalized into an RSSFeed.
+func parseFeed(data []byte, contentType string) (*RSSFeed, error) {
+	data, err := decodeBody(data, contentType)
+	if err != nil {
+		return nil, err
+	}
+	if isJSONFeed(data, contentType) {
+		return parseJSONFeed(data)
+	}
+	root, err := xmlRootName(data)
+	if err != nil {
+		return nil, fmt.Errorf("Could not Unmarshal: %v", err)
+	}
+	switch root.Local {
+	case "feed":
+		return parseAtom(data)
+	case "RDF":
+		return parseRDF(data)
+	case "rss":
+		var feed RSSFeed
+		if err := newXMLDecoder(data).Decode(&feed); err != nil {
+			return nil, fmt.Errorf("Could not Unmarshal: %v", err)
+		}
+		feed.Format = strings.TrimSpace("RSS " + feed.Version)
+		feed.Channel.Image = strings.TrimSpace(feed.Channel.RSSImage.URL)
+		if feed.Channel.Image == "" {
+			feed.Channel.Image = strings.TrimSpace(feed.Channel.ITunesImage.Href)
+		}
+		for i, item := range feed.Channel.Item {
+			if strings.TrimSpace(item.Author) == "" {
+				feed.Channel.Item[i].Author = item.Creator
+			}
+			if strings.TrimSpace(feed.Channel.Item[i].Author) == "" {
+				feed.Channel.Item[i].Author = item.ITunesAuthor
+			}
+			if strings.TrimSpace(item.Description) == "" {
+				feed.Channel.Item[i].Description = item.summary()
+			}
+			feed.Channel.Item[i].Enclosures = item.enclosures()
+		}
+		return &feed, nil
+	default:
+		return nil, fmt.Errorf("Unsupported feed format: <%v>", root.Local)
+	}
+}
+
+func isJSONFeed(data []byte, contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/feed+json" || mediaType == "application/json":
+		return true
+	case strings.HasSuffix(mediaType, "xml"):
+		return false
+	}
+	trimmed := bytes.TrimLeft(bytes.TrimPrefix(data, utf8BOM), " \t\r\n")
+	return len(trimmed) > 0 && trimmed[0] == '{'
+}
+
+// checkContentType rejects media types that can never be a feed before
+// the body is read.
+func checkContentType(contentType string) error {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	for _, prefix := range []string{"image/", "audio/", "video/", "font/", "application/pdf", "application/zip"} {
+		if strings.HasPrefix(mediaType, prefix) {
+			return &notFeedError{ContentType: contentType}
+		}
+	}
+	return nil
+}
+
+// isHTML reports whether a response is a web page, by its Content-Type or,
+// when that is missing or generic, by sniffing the body.
+func isHTML(data []byte, contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "" || mediaType == "application/octet-stream" || mediaType == "text/plain" {
+		mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(data))
+	}
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// looksLikeFeed reports whether data has a feed's root element, for
+// publishers that mislabel their feeds as text/html.
+func looksLikeFeed(data []byte, contentType string) bool {
+	if isJSONFeed(data, contentType) {
+		return true
+	}
+	root, err := xmlRootName(data)
+	if err != nil {
+		return false
+	}
+	switch root.Local {
+	case "rss", "feed", "RDF":
+		return true
+	}
+	return false
+}
+
+func xmlRootName(data []byte) (xml.Name, error) {
+	decoder := newXMLDecoder(data)
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			return xml.Name{}, err
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return start.Name, nil
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseFeed(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		format      string
+		title       string
+		link        string
+		items       []RSSItem
+	}{
+		{
+			name:        "RSS 2.0",
+			contentType: "application/rss+xml",
+			body: `<?xml version="1.0"?>
+<rss version="2.0" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<channel><title>Blog</title><link>https://example.com/</link>
+<item><title>First</title><link>https://example.com/1</link><description>One</description>
+<pubDate>Mon, 02 Jan 2006 15:04:05 +0000</pubDate><guid>id-1</guid><dc:creator>Ann</dc:creator></item>
+</channel></rss>`,
+			format: "RSS 2.0",
+			title:  "Blog",
+			link:   "https://example.com/",
+			items: []RSSItem{
+				{Title: "First", Link: "https://example.com/1", Description: "One", GUID: "id-1", Author: "Ann"},
+			},
+		},
+		{
+			name:        "RSS 2.0 with atom:link",
+			contentType: "application/rss+xml",
+			body: `<?xml version="1.0"?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom">
+<channel><title>Hugo Site</title><link>https://site.example/</link>
+<atom:link href="https://site.example/index.xml" rel="self" type="application/rss+xml"/>
+<item><title>Post</title><link>https://site.example/post/</link><guid>https://site.example/post/</guid></item>
+</channel></rss>`,
+			format: "RSS 2.0",
+			title:  "Hugo Site",
+			link:   "https://site.example/",
+			items: []RSSItem{
+				{Title: "Post", Link: "https://site.example/post/", GUID: "https://site.example/post/"},
+			},
+		},
+		{
+			name:        "Atom 1.0",
+			contentType: "application/atom+xml",
+			body: `<feed xmlns="http://www.w3.org/2005/Atom"><title>Atom Blog</title>
+<entry><id>urn:1</id><title>Plain</title><link href="https://example.com/a"/>
+<summary type="html">&lt;p&gt;Hi&lt;/p&gt;</summary></entry>
+</feed>`,
+			format: "Atom 1.0",
+			title:  "Atom Blog",
+			items: []RSSItem{
+				{Title: "Plain", Link: "https://example.com/a", Description: "<p>Hi</p>", GUID: "urn:1"},
+			},
+		},
+		{
+			name:        "Atom xhtml content and title",
+			contentType: "application/atom+xml",
+			body: `<feed xmlns="http://www.w3.org/2005/Atom"><title type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml">X<b>HTML</b> Blog</div></title>
+<entry><id>urn:2</id><title type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml">Hello <em>there</em></div></title>
+<link rel="alternate" href="https://example.com/b"/><link rel="self" href="https://example.com/b.atom"/>
+<content type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml"><p>Body</p></div></content></entry>
+</feed>`,
+			format: "Atom 1.0",
+			title:  "XHTML Blog",
+			items: []RSSItem{
+				{Title: "Hello there", Link: "https://example.com/b", Description: "<p>Body</p>", GUID: "urn:2", Content: "<p>Body</p>"},
+			},
+		},
+		{
+			name:        "RSS 1.0",
+			contentType: "application/rdf+xml",
+			body: `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/">
+<channel rdf:about="https://example.org/"><title>Gov</title><link>https://example.org/</link></channel>
+<item rdf:about="https://example.org/r1"><title>Report</title><link>https://example.org/r1</link><description>Annual</description></item>
+</rdf:RDF>`,
+			format: "RSS 1.0 (RDF)",
+			title:  "Gov",
+			link:   "https://example.org/",
+			items: []RSSItem{
+				{Title: "Report", Link: "https://example.org/r1", Description: "Annual", GUID: "https://example.org/r1"},
+			},
+		},
+		{
+			name:        "JSON Feed sniffed",
+			contentType: "text/plain",
+			body: `{"version": "https://jsonfeed.org/version/1.1", "title": "JSON Blog",
+"items": [{"id": 7, "url": "https://example.net/7", "title": "Seven", "summary": "Sum"}]}`,
+			format: "JSON Feed 1.1",
+			title:  "JSON Blog",
+			items: []RSSItem{
+				{Title: "Seven", Link: "https://example.net/7", Description: "Sum", GUID: "7"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feed, err := parseFeed([]byte(tt.body), tt.contentType)
+			if err != nil {
+				t.Fatalf("parseFeed: %v", err)
+			}
+			if feed.Format != tt.format || feed.Channel.Title != tt.title {
+				t.Errorf("got format %q title %q, want %q %q", feed.Format, feed.Channel.Title, tt.format, tt.title)
+			}
+			if got := strings.TrimSpace(feed.Channel.Link); got != tt.link {
+				t.Errorf("got link %q, want %q", got, tt.link)
+			}
+			if len(feed.Channel.Item) != len(tt.items) {
+				t.Fatalf("got %d items, want %d", len(feed.Channel.Item), len(tt.items))
+			}
+			for i, want := range tt.items {
+				got := feed.Channel.Item[i]
+				if strings.TrimSpace(got.Title) != want.Title ||
+					strings.TrimSpace(got.Link) != want.Link ||
+					strings.TrimSpace(got.Description) != want.Description ||
+					itemGUID(got) != want.GUID ||
+					strings.TrimSpace(got.Author) != want.Author ||
+					strings.TrimSpace(got.Content) != want.Content {
+					t.Errorf("item %d = %+v, want %+v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseFeedUnsupported(t *testing.T) {
+	if _, err := parseFeed([]byte(`<opml version="2.0"></opml>`), "text/xml"); err == nil {
+		t.Error("parseFeed accepted an OPML document")
+	}
+}
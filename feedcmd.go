@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/AkuPython/Gator/internal/database"
+)
+
+const feedUsage = "Usage: feed rm <feed> | feed rename <feed> <name> | feed set-url <feed> <url> [--force]"
+
+// handlerFeed edits a single feed, given by URL or name. Only the user who
+// added the feed or an admin may change it.
+func handlerFeed(s *state, cmd command, user database.User) error {
+	if len(cmd.Args) < 2 {
+		return errors.New(feedUsage)
+	}
+	ctx := context.Background()
+	feed, err := lookupFeed(ctx, s, cmd.Args[1])
+	if err != nil {
+		return err
+	}
+	if feed.UserID != user.ID && !user.IsAdmin {
+		return fmt.Errorf("Only the user who added %v or an admin can change it", feed.Name)
+	}
+
+	switch cmd.Args[0] {
+	case "rm":
+		if len(cmd.Args) != 2 {
+			return errors.New(feedUsage)
+		}
+		return removeFeed(ctx, s, feed)
+	case "rename":
+		if len(cmd.Args) != 3 || cmd.Args[2] == "" {
+			return errors.New(feedUsage)
+		}
+		err := s.db.RenameFeed(ctx, database.RenameFeedParams{ID: feed.ID, Name: cmd.Args[2]})
+		if err != nil {
+			return fmt.Errorf("Could not rename feed %v: %v", feed.Name, err)
+		}
+		fmt.Printf("Renamed %v to %v\n", feed.Name, cmd.Args[2])
+		return nil
+	case "set-url":
+		return setFeedURL(ctx, s, feed, cmd.Args[2:])
+	}
+	return errors.New(feedUsage)
+}
+
+// lookupFeed finds a feed by URL, falling back to its name. A name shared by
+// several feeds is an error, as guessing could remove the wrong one.
+func lookupFeed(ctx context.Context, s *state, ref string) (database.Feed, error) {
+	feed, err := getFeedByURL(ctx, s, ref)
+	if err == nil {
+		return feed, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.Feed{}, fmt.Errorf("Could not get feed %v: %v", ref, err)
+	}
+	feeds, err := s.db.GetFeedsByName(ctx, ref)
+	if err != nil {
+		return database.Feed{}, fmt.Errorf("Could not get feed %v from DB: %v", ref, err)
+	}
+	switch len(feeds) {
+	case 0:
+		return database.Feed{}, fmt.Errorf("No feed with URL or name %v", ref)
+	case 1:
+		return feeds[0], nil
+	}
+	urls := make([]string, len(feeds))
+	for i, feed := range feeds {
+		urls[i] = feed.Url
+	}
+	return database.Feed{}, fmt.Errorf("Ambiguous name %v, use the URL of one of:\n\t%v", ref, strings.Join(urls, "\n\t"))
+}
+
+// removeFeed deletes a feed along with its follows and posts, counting them
+// in the same transaction so the report matches what was deleted. Posts
+// someone starred are kept without a feed.
+func removeFeed(ctx context.Context, s *state, feed database.Feed) error {
+	tx, err := s.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("Could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+	q := s.db.WithTx(tx)
+
+	follows, err := q.CountFeedFollows(ctx, feed.ID)
+	if err != nil {
+		return fmt.Errorf("Could not count follows of %v: %v", feed.Name, err)
+	}
+	posts, err := q.CountFeedPosts(ctx, nullFeedID(feed.ID))
+	if err != nil {
+		return fmt.Errorf("Could not count posts of %v: %v", feed.Name, err)
+	}
+	deleted, err := q.DeleteUnstarredFeedPosts(ctx, nullFeedID(feed.ID))
+	if err != nil {
+		return fmt.Errorf("Could not delete posts of %v: %v", feed.Name, err)
+	}
+	if err := q.DeleteFeed(ctx, feed.ID); err != nil {
+		return fmt.Errorf("Could not delete feed %v: %v", feed.Name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Could not delete feed %v: %v", feed.Name, err)
+	}
+	fmt.Printf("Removed feed %v (%v) with %v follows and %v posts\n", feed.Name, feed.Url, follows, deleted)
+	if kept := posts - deleted; kept > 0 {
+		fmt.Printf("Kept %v starred posts\n", kept)
+	}
+	return nil
+}
+
+// setFeedURL points a feed at a new URL after checking it serves a feed,
+// unless --force is given.
+func setFeedURL(ctx context.Context, s *state, feed database.Feed, args []string) error {
+	fs := flag.NewFlagSet("set-url", flag.ContinueOnError)
+	force := fs.Bool("force", false, "change the URL even if it can't be fetched or parsed")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errors.New(feedUsage)
+	}
+	newURL := normalizeURL(args[0])
+
+	if existing, err := getFeedByURL(ctx, s, newURL); err == nil && existing.ID != feed.ID {
+		return fmt.Errorf("%v is already the URL of feed %v", newURL, existing.Name)
+	} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	resp, err := s.fetcher.fetchFeed(ctx, newURL, "", "")
+	if err != nil {
+		if !*force {
+			return fmt.Errorf("Could not validate feed %v: %v\n\tre-run with --force to change it anyway", newURL, err)
+		}
+		fmt.Printf("Warning: could not validate feed %v: %v\n", newURL, err)
+	} else {
+		printFeedPreview(resp.Feed)
+	}
+
+	err = s.db.ChangeFeedURL(ctx, database.ChangeFeedURLParams{
+		ID:           feed.ID,
+		Url:          newURL,
+		CanonicalUrl: sql.NullString{String: canonicalURL(newURL), Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("Could not change URL of feed %v: %v", feed.Name, err)
+	}
+	fmt.Printf("Changed URL of %v from %v to %v\n", feed.Name, feed.Url, newURL)
+	return nil
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/AkuPython/Gator/internal/config"
+)
+
+const (
+	retryBaseDelay = time.Second
+	retryMaxDelay  = 30 * time.Second
+	// maxRetryWait is the longest Retry-After a fetch will sleep through;
+	// anything longer is left to the feed's schedule.
+	maxRetryWait = time.Minute
+	// hostBurst is how many requests a host may receive back to back
+	// before its rate limit applies.
+	hostBurst = 3
+)
+
+// fetcher is the HTTP client shared by every feed request. It retries
+// transient failures and rate limits requests per host, so concurrent
+// aggregator workers don't hammer a single origin.
+type fetcher struct {
+	client *http.Client
+	// downloads shares client's transport but has no total timeout, as
+	// media files can take far longer than a feed; stalls are still caught
+	// by the read timeout.
+	downloads  *http.Client
+	limiter    *hostLimiter
+	maxRetries int
+	maxBytes   int64
+}
+
+func newFetcher(cfg *config.Config) (*fetcher, error) {
+	connectTimeout, readTimeout, totalTimeout, err := cfg.FetchTimeouts()
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: connectTimeout}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &readTimeoutConn{Conn: conn, timeout: readTimeout}, nil
+	}
+	transport.TLSHandshakeTimeout = connectTimeout
+	transport.ResponseHeaderTimeout = readTimeout
+
+	return &fetcher{
+		client:     &http.Client{Transport: transport, Timeout: totalTimeout},
+		downloads:  &http.Client{Transport: transport},
+		limiter:    newHostLimiter(cfg.HostRequestsPerMinute(), hostBurst),
+		maxRetries: cfg.FetchRetries(),
+		maxBytes:   cfg.MaxFeedSize(),
+	}, nil
+}
+
+// readTimeoutConn fails a read that waits longer than timeout, so a server
+// that stops sending mid-body is caught without waiting for the total
+// timeout.
+type readTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *readTimeoutConn) Read(b []byte) (int, error) {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+// readBody reads at most f.maxBytes of a response body.
+func (f *fetcher) readBody(resp *http.Response) ([]byte, error) {
+	if resp.ContentLength > f.maxBytes {
+		return nil, &bodyTooLargeError{Limit: f.maxBytes}
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, f.maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("Could not read response body: %v", err)
+	}
+	if int64(len(body)) > f.maxBytes {
+		return nil, &bodyTooLargeError{Limit: f.maxBytes}
+	}
+	return body, nil
+}
+
+// bodyTooLargeError is returned for responses over the max_feed_bytes limit.
+type bodyTooLargeError struct {
+	Limit int64
+}
+
+func (e *bodyTooLargeError) Error() string {
+	return fmt.Sprintf("Response body exceeds the %v byte limit", e.Limit)
+}
+
+// notFeedError is returned for responses that are clearly not a feed, such
+// as an HTML error page or an image. HTML is set for web pages, which may
+// advertise the feeds they publish.
+type notFeedError struct {
+	ContentType string
+	HTML        bool
+}
+
+func (e *notFeedError) Error() string {
+	return fmt.Sprintf("Response is not a feed (Content-Type: %v)", e.ContentType)
+}
+
+// httpStatusError is returned when a feed answers with anything other
+// than a 2xx or 304.
+type httpStatusError struct {
+	StatusCode int
+	Status     string
+	RetryAfter time.Duration
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("Unexpected HTTP status: %v", e.Status)
+}
+
+// get sends req, retrying timeouts, 5xx and 429 responses with jittered
+// exponential backoff or the server's Retry-After. Responses other than
+// 2xx and 304 are returned as an *httpStatusError.
+func (f *fetcher) get(ctx context.Context, req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if err := f.limiter.wait(ctx, req.URL.Host); err != nil {
+			return nil, err
+		}
+		resp, err := f.client.Do(req.Clone(ctx))
+		var delay time.Duration
+		if err == nil {
+			if resp.StatusCode == http.StatusNotModified || (resp.StatusCode >= 200 && resp.StatusCode <= 299) {
+				return resp, nil
+			}
+			statusErr := &httpStatusError{
+				StatusCode: resp.StatusCode,
+				Status:     resp.Status,
+				RetryAfter: retryAfter(resp.Header, time.Now()),
+			}
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+			if !retryableStatus(resp.StatusCode) {
+				return nil, statusErr
+			}
+			err = statusErr
+			delay = statusErr.RetryAfter
+		} else if ctx.Err() != nil || !retryableError(err) {
+			return nil, fmt.Errorf("client.Do error: %v", err)
+		}
+
+		if attempt >= f.maxRetries {
+			return nil, err
+		}
+		if delay == 0 {
+			delay = backoff(attempt)
+		}
+		if delay > maxRetryWait {
+			return nil, err
+		}
+		log.Printf("Retrying %v in %v: %v", req.URL, delay.Round(time.Millisecond), err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
+
+// permanentLocation returns the URL the request behind resp has permanently
+// moved to: the last one reached through 301 and 308 redirects alone. It is
+// empty when the first hop, if any, was not permanent.
+func permanentLocation(resp *http.Response) string {
+	// Each redirected request holds the response that caused it, so walk
+	// back from the final request to the original.
+	var chain []*http.Request
+	for req := resp.Request; req != nil; req = req.Response.Request {
+		chain = append(chain, req)
+		if req.Response == nil {
+			break
+		}
+	}
+	location := ""
+	for i := len(chain) - 2; i >= 0; i-- {
+		code := chain[i].Response.StatusCode
+		if code != http.StatusMovedPermanently && code != http.StatusPermanentRedirect {
+			break
+		}
+		location = chain[i].URL.String()
+	}
+	return location
+}
+
+// backoff returns a delay in [d/2, d) where d doubles with each attempt.
+func backoff(attempt int) time.Duration {
+	d := min(retryBaseDelay<<attempt, retryMaxDelay)
+	return d/2 + rand.N(d/2)
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+func retryableError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF)
+}
+
+// hostLimiter is a token bucket per host.
+type hostLimiter struct {
+	mu      sync.Mutex
+	rate    float64 // tokens per second
+	burst   float64
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newHostLimiter(perMinute, burst int) *hostLimiter {
+	return &hostLimiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// wait blocks until host has a token to spend or ctx is done.
+func (l *hostLimiter) wait(ctx context.Context, host string) error {
+	for {
+		delay := l.reserve(host)
+		if delay == 0 {
+			return nil
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve takes a token for host if one is available and returns 0,
+// otherwise it returns how long until the next token is due.
+func (l *hostLimiter) reserve(host string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, ok := l.buckets[host]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[host] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
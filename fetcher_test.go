@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testFetcher(client *http.Client) *fetcher {
+	return &fetcher{
+		client:     client,
+		downloads:  client,
+		limiter:    newHostLimiter(6000, 100),
+		maxRetries: 3,
+		maxBytes:   1 << 20,
+	}
+}
+
+func TestFetcherGet(t *testing.T) {
+	tests := []struct {
+		name string
+		// responses are sent in turn, the last one repeating.
+		responses  []func(w http.ResponseWriter)
+		wantStatus int
+		wantTries  int32
+		minElapsed time.Duration
+		maxElapsed time.Duration
+	}{
+		{
+			name: "503 then 200 is retried",
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusServiceUnavailable) },
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusOK) },
+			},
+			wantStatus: http.StatusOK,
+			wantTries:  2,
+			maxElapsed: retryBaseDelay + time.Second,
+		},
+		{
+			name: "429 honors Retry-After",
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) {
+					w.Header().Set("Retry-After", "1")
+					w.WriteHeader(http.StatusTooManyRequests)
+				},
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusOK) },
+			},
+			wantStatus: http.StatusOK,
+			wantTries:  2,
+			minElapsed: time.Second,
+			maxElapsed: 3 * time.Second,
+		},
+		{
+			name: "429 with a Retry-After too long to wait for",
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) {
+					w.Header().Set("Retry-After", "3600")
+					w.WriteHeader(http.StatusTooManyRequests)
+				},
+			},
+			wantStatus: http.StatusTooManyRequests,
+			wantTries:  1,
+			maxElapsed: time.Second,
+		},
+		{
+			name: "404 is not retried",
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusNotFound) },
+			},
+			wantStatus: http.StatusNotFound,
+			wantTries:  1,
+			maxElapsed: time.Second,
+		},
+		{
+			name: "304 is a success",
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusNotModified) },
+			},
+			wantStatus: http.StatusNotModified,
+			wantTries:  1,
+			maxElapsed: time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tries atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(tries.Add(1))
+				tt.responses[min(n, len(tt.responses))-1](w)
+			}))
+			defer srv.Close()
+
+			ctx := context.Background()
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			start := time.Now()
+			resp, err := testFetcher(srv.Client()).get(ctx, req)
+			elapsed := time.Since(start)
+
+			status := 0
+			var statusErr *httpStatusError
+			switch {
+			case err == nil:
+				status = resp.StatusCode
+				resp.Body.Close()
+			case errors.As(err, &statusErr):
+				status = statusErr.StatusCode
+			default:
+				t.Fatalf("get: %v", err)
+			}
+			if status != tt.wantStatus {
+				t.Errorf("got status %v, want %v", status, tt.wantStatus)
+			}
+			if got := tries.Load(); got != tt.wantTries {
+				t.Errorf("got %v requests, want %v", got, tt.wantTries)
+			}
+			if elapsed < tt.minElapsed || elapsed > tt.maxElapsed {
+				t.Errorf("took %v, want between %v and %v", elapsed, tt.minElapsed, tt.maxElapsed)
+			}
+		})
+	}
+}
+
+func TestFetcherGetRetryAfterError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = testFetcher(srv.Client()).get(context.Background(), req)
+	var statusErr *httpStatusError
+	if !errors.As(err, &statusErr) || statusErr.RetryAfter != time.Hour {
+		t.Errorf("get() error = %v, want an httpStatusError with a 1h Retry-After", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt := 0; attempt < 10; attempt++ {
+		d := min(retryBaseDelay<<attempt, retryMaxDelay)
+		for i := 0; i < 20; i++ {
+			if got := backoff(attempt); got < d/2 || got >= d {
+				t.Fatalf("backoff(%v) = %v, want in [%v, %v)", attempt, got, d/2, d)
+			}
+		}
+	}
+}
+
+func TestHostLimiterReserve(t *testing.T) {
+	// One token a second, bursts of two.
+	l := newHostLimiter(60, 2)
+
+	for i := 0; i < 2; i++ {
+		if delay := l.reserve("a.example"); delay != 0 {
+			t.Fatalf("request %v within the burst delayed by %v", i+1, delay)
+		}
+	}
+	if delay := l.reserve("a.example"); delay <= 900*time.Millisecond || delay > time.Second {
+		t.Errorf("request past the burst delayed by %v, want about 1s", delay)
+	}
+	if delay := l.reserve("b.example"); delay != 0 {
+		t.Errorf("another host delayed by %v", delay)
+	}
+
+	// Half a second refills half a token.
+	l.buckets["a.example"].last = l.buckets["a.example"].last.Add(-500 * time.Millisecond)
+	if delay := l.reserve("a.example"); delay <= 400*time.Millisecond || delay > 500*time.Millisecond {
+		t.Errorf("request after half a token refilled delayed by %v, want about 0.5s", delay)
+	}
+	l.buckets["a.example"].last = l.buckets["a.example"].last.Add(-500 * time.Millisecond)
+	if delay := l.reserve("a.example"); delay != 0 {
+		t.Errorf("request after a token refilled delayed by %v", delay)
+	}
+
+	// A long idle period refills no more than the burst.
+	l.buckets["a.example"].last = l.buckets["a.example"].last.Add(-time.Hour)
+	for i := 0; i < 2; i++ {
+		if delay := l.reserve("a.example"); delay != 0 {
+			t.Fatalf("request %v after idling delayed by %v", i+1, delay)
+		}
+	}
+	if delay := l.reserve("a.example"); delay == 0 {
+		t.Error("idle host got more than its burst")
+	}
+}
+
+func TestPermanentLocation(t *testing.T) {
+	redirects := map[string]struct {
+		code int
+		to   string
+	}{
+		"/301":         {http.StatusMovedPermanently, "/ok"},
+		"/308":         {http.StatusPermanentRedirect, "/ok"},
+		"/301-302":     {http.StatusMovedPermanently, "/302"},
+		"/302":         {http.StatusFound, "/ok"},
+		"/302-301":     {http.StatusFound, "/301"},
+		"/301-301-308": {http.StatusMovedPermanently, "/301-308"},
+		"/301-308":     {http.StatusMovedPermanently, "/308"},
+		"/307":         {http.StatusTemporaryRedirect, "/ok"},
+		"/301-missing": {http.StatusMovedPermanently, "/missing"},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		if redirect, ok := redirects[r.URL.Path]; ok {
+			http.Redirect(w, r, redirect.to, redirect.code)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/ok", ""},
+		{"/301", "/ok"},
+		{"/308", "/ok"},
+		{"/301-302", "/302"},
+		{"/302-301", ""},
+		{"/301-301-308", "/ok"},
+		{"/307", ""},
+		{"/301-missing", "/missing"},
+	}
+	for _, tt := range tests {
+		resp, err := srv.Client().Get(srv.URL + tt.path)
+		if err != nil {
+			t.Fatalf("GET %v: %v", tt.path, err)
+		}
+		resp.Body.Close()
+		want := ""
+		if tt.want != "" {
+			want = srv.URL + tt.want
+		}
+		if got := permanentLocation(resp); got != want {
+			t.Errorf("permanentLocation(%v) = %q, want %q", tt.path, got, want)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"strconv"
@@ -29,6 +31,24 @@ func (c *commands) register(name string, f func(*state, command) error) {
 	c.Command[name] = f
 }
 
+// parseFlags parses args with fs, allowing flags before, between and after
+// the positional arguments, which it returns in order.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		// Everything after a "--" terminator is positional.
+		if consumed := len(args) - len(rest); len(rest) == 0 || (consumed > 0 && args[consumed-1] == "--") {
+			return append(positional, rest...), nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
 func middlewareLoggedIn(handler func(s *state, cmd command, user database.User) error) func(*state, command) error {
 	return func(s *state, cmd command) error {
 		user, err := s.db.GetUser(context.Background(), s.cfg.CurrentUserName)
@@ -83,7 +103,13 @@ func handlerRegister(s *state, cmd command) error {
 }
 
 func handlerReset(s *state, cmd command) error {
-	return s.db.DeleteUsers(context.Background())
+	if err := s.db.DeleteUsers(context.Background()); err != nil {
+		return err
+	}
+	// Deleting users deletes their feeds and stars, which leaves the
+	// starred posts kept from those feeds behind.
+	_, err := s.db.DeleteOrphanedPosts(context.Background())
+	return err
 }
 
 func handlerGetUsers(s *state, cmd command) error {
@@ -92,98 +118,80 @@ func handlerGetUsers(s *state, cmd command) error {
 		log.Fatalf("Could not get users from DB - %v", err)
 	}
 	for _, user := range users {
+		name := user.Name
+		if user.IsAdmin {
+			name += " (admin)"
+		}
 		if user.Name == s.cfg.CurrentUserName {
-			fmt.Println("*", user.Name, "(current)")
+			fmt.Println("*", name, "(current)")
 		} else {
-			fmt.Println("*", user.Name)
+			fmt.Println("*", name)
 		}
 	}
 	return nil
 }
 
-func scrapeFeeds(s *state) {
-	feed, err := s.db.GetNextFeedToFetch(context.Background())
+func handlerAddFeed(s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	force := fs.Bool("force", false, "add the feed even if it can't be fetched or parsed")
+	args, err := parseFlags(fs, cmd.Args)
 	if err != nil {
-		fmt.Println("Could not get next feed to fetch", err)
-		return
+		return err
+	}
+	var name, rawURL string
+	switch len(args) {
+	case 1:
+		rawURL = args[0]
+	case 2:
+		name, rawURL = args[0], args[1]
+	default:
+		return fmt.Errorf("Must provide url and optionally a name: addfeed [name] <url> [--force]")
+	}
+	if feed, err := getFeedByURL(context.Background(), s, rawURL); err == nil {
+		return followAddedFeed(s, user, feed)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
 	}
-	fmt.Println("fetching feed:", feed.Name)
-	err = s.db.MarkFeedFetched(context.Background(), feed.ID)
-	if err != nil {
-		fmt.Printf("Couldn't mark feed: %v as fetched: %v", feed.ID, err)
-		return
+
+	feedURL, resp, err := resolveFeedURL(context.Background(), s, normalizeURL(rawURL))
+	if feedURL == "" {
+		return err
 	}
-		feedData, err := fetchFeed(context.Background(), feed.Url)
 	if err != nil {
-		fmt.Printf("Couldn't collect feed %s: %v", feed.Name, err)
-		return
-	}
-	for _, item := range feedData.Channel.Item {
-		publishedAt := sql.NullTime{}
-		if t, err := time.Parse(time.RFC1123Z, item.PubDate); err == nil {
-			publishedAt = sql.NullTime{
-				Time:  t,
-				Valid: true,
-			}
+		if !*force {
+			return fmt.Errorf("Could not validate feed %v: %v\n\tre-run with --force to add it anyway", feedURL, err)
 		}
-
-		_, err = s.db.CreatePost(context.Background(), database.CreatePostParams{
-			ID:        uuid.New(),
-			CreatedAt: time.Now().UTC(),
-			UpdatedAt: time.Now().UTC(),
-			FeedID:    feed.ID,
-			Title:     item.Title,
-			Description: sql.NullString{
-				String: item.Description,
-				Valid:  true,
-			},
-			Url:         item.Link,
-			PublishedAt: publishedAt,
-		})
-		if err != nil {
-			if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
-				continue
-			}
-			log.Printf("Couldn't create post: %v", err)
-			continue
+		fmt.Printf("Warning: could not validate feed %v: %v\n", feedURL, err)
+	} else {
+		if resp.PermanentURL != "" {
+			fmt.Printf("%v has moved permanently, adding %v instead\n", feedURL, resp.PermanentURL)
+			feedURL = resp.PermanentURL
+		}
+		printFeedPreview(resp.Feed)
+		if name == "" {
+			name = strings.TrimSpace(resp.Feed.Channel.Title)
 		}
 	}
-	log.Printf("Feed %s collected, %v posts found", feed.Name, len(feedData.Channel.Item))
-}
-
-func handlerAgg(s *state, cmd command) error {
-	if len(cmd.Args) != 1 {
-		return fmt.Errorf("Must provide interval (1m, 1h, etc)")
-	}
-	scrapeInterval, err := time.ParseDuration(cmd.Args[0])
-	if err != nil {
-		return fmt.Errorf("invalid duration: %v", err)
-	}
-	if scrapeInterval < time.Duration(30 * time.Second) {
-		return fmt.Errorf("Interval too short, must be at least 30s")
+	feedURL = normalizeURL(feedURL)
+	if feedURL != normalizeURL(rawURL) {
+		if feed, err := getFeedByURL(context.Background(), s, feedURL); err == nil {
+			return followAddedFeed(s, user, feed)
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
 	}
-	log.Printf("Collecting feeds every %s...", scrapeInterval)
-
-	ticker := time.NewTicker(scrapeInterval)
-
-	for ; ; <-ticker.C {
-		scrapeFeeds(s)
+	if name == "" {
+		return fmt.Errorf("Feed has no title, provide a name: addfeed <name> %v", feedURL)
 	}
-	// return nil
-}
 
-func handlerAddFeed(s *state, cmd command, user database.User) error {
-	if len(cmd.Args) != 2 {
-		return fmt.Errorf("Must provide name & url")
-	}
-	
 	feed, err := s.db.CreateFeed(context.Background(), database.CreateFeedParams{
 		ID: uuid.New(),
 		CreatedAt: time.Now().UTC(),
 		UpdatedAt: time.Now().UTC(),
-		Name: cmd.Args[0],
-		Url: cmd.Args[1],
+		Name: name,
+		Url: feedURL,
 		UserID: user.ID,
+		CanonicalUrl: sql.NullString{String: canonicalURL(feedURL), Valid: true},
 	})
 
 	if err != nil {
@@ -202,40 +210,128 @@ func handlerAddFeed(s *state, cmd command, user database.User) error {
 	if err != nil {
 		return fmt.Errorf("Could not create Feed Follow for User: %v, Feed: %v", user.ID, feed.ID)
 	}
+	fmt.Printf("Added feed %v (%v)\n", feed.Name, feed.Url)
 	return nil
 }
 
-func handlerBrowse(s *state, cmd command, user database.User) error {
-	limit := 2
-	if len(cmd.Args) == 1 {
-		if limit2, err := strconv.Atoi(cmd.Args[0]); err == nil {
-			limit = limit2
-		} else {
-			return fmt.Errorf("invalid limit: %w", err)
-		}
-	}
+func printFeedPreview(feed *RSSFeed) {
+	fmt.Printf("Format: %v\nTitle:  %v\nItems:  %v\n", feed.Format, feed.Channel.Title, len(feed.Channel.Item))
+}
 
-	posts, err := s.db.GetPostsForUser(context.Background(), database.GetPostsForUserParams{
+// followAddedFeed follows a feed someone has already added instead of
+// adding it twice.
+func followAddedFeed(s *state, user database.User, feed database.Feed) error {
+	_, err := s.db.CreateFeedFollow(context.Background(), database.CreateFeedFollowParams{
+		ID: uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
 		UserID: user.ID,
-		Limit:  int32(limit),
+		FeedID: feed.ID,
 	})
+	if err != nil {
+		return fmt.Errorf("Feed %v (%v) was already added, could not follow it: %v", feed.Name, feed.Url, err)
+	}
+	fmt.Printf("Feed %v (%v) was already added, now following it\n", feed.Name, feed.Url)
+	return nil
+}
+
+func handlerBrowse(s *state, cmd command, user database.User) error {
+	params, err := browseParams(context.Background(), s, user, cmd)
+	if err != nil {
+		return err
+	}
+	posts, err := s.db.GetPostsForUser(context.Background(), params)
 	if err != nil {
 		return fmt.Errorf("couldn't get posts for user: %w", err)
 	}
 
-	fmt.Printf("Found %d posts for user %s:\n", len(posts), user.Name)
+	postIDs := make([]uuid.UUID, len(posts))
+	for i, post := range posts {
+		postIDs[i] = post.ID
+	}
+	enclosures, err := s.db.GetEnclosuresForPosts(context.Background(), postIDs)
+	if err != nil {
+		return fmt.Errorf("couldn't get enclosures for posts: %w", err)
+	}
+	attachments := map[uuid.UUID][]database.Enclosure{}
+	for _, enclosure := range enclosures {
+		attachments[enclosure.PostID] = append(attachments[enclosure.PostID], enclosure)
+	}
+
+	if params.ReadState == "all" {
+		fmt.Printf("Found %d posts for user %s:\n", len(posts), user.Name)
+	} else {
+		fmt.Printf("Found %d %s posts for user %s:\n", len(posts), params.ReadState, user.Name)
+	}
 	for _, post := range posts {
-		fmt.Printf("%s from %s\n", post.PublishedAt.Time.Format("Mon Jan 2"), post.FeedName)
-		fmt.Printf("--- %s ---\n", post.Title)
+		published := post.PublishedAt.Format("Mon Jan 2")
+		if post.PublishedAtSource == dateSourceFirstSeen {
+			published += " (first seen)"
+		}
+		if post.Author.Valid {
+			fmt.Printf("%s from %s by %s\n", published, post.FeedName, post.Author.String)
+		} else {
+			fmt.Printf("%s from %s\n", published, post.FeedName)
+		}
+		title := fmt.Sprintf("--- %s ---", post.Title)
+		if post.Read {
+			title += " (read)"
+		}
+		if post.Starred {
+			title += " (starred)"
+		}
+		fmt.Println(title)
 		fmt.Printf("    %v\n", post.Description.String)
+		if len(post.Categories) > 0 {
+			fmt.Printf("Tags: %s\n", strings.Join(post.Categories, ", "))
+		}
 		fmt.Printf("Link: %s\n", post.Url)
+		if post.CommentsUrl.Valid {
+			fmt.Printf("Comments: %s\n", post.CommentsUrl.String)
+		}
+		for _, enclosure := range attachments[post.ID] {
+			details := []string{formatSize(enclosure.Length.Int64)}
+			if enclosure.MimeType.Valid {
+				details = append([]string{enclosure.MimeType.String}, details...)
+			}
+			if enclosure.DurationSeconds.Valid {
+				details = append(details, formatDuration(enclosure.DurationSeconds.Int32))
+			}
+			fmt.Printf("Attachment: %s (%s)\n", enclosure.Url, strings.Join(details, ", "))
+		}
+		fmt.Printf("Post ID: %s\n", post.ID)
 		fmt.Println("=====================================")
 	}
+	if len(posts) == int(params.PostLimit) {
+		fmt.Printf("More posts: repeat with %s instead of any --page/--offset/--after\n", nextBrowsePage(params, posts))
+	}
+	if len(posts) > 0 {
+		fmt.Println("Mark posts as read with 'gator read <post id>', or keep them with 'gator star <post id>'")
+	}
+	if len(enclosures) > 0 {
+		fmt.Println("Download a post's attachments with 'gator enclosures download <post id>'")
+	}
 
 	return nil
 }
 
 func handlerGetFeeds(s *state, cmd command) error {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	health := fs.Bool("health", false, "show feeds that are failing or disabled")
+	enable := fs.String("enable", "", "re-enable the disabled feed with this URL")
+	if err := fs.Parse(cmd.Args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("Unexpected arguments: %v", fs.Args())
+	}
+	if *enable != "" {
+		return enableFeed(s, *enable)
+	}
+	if *health {
+		return printFeedHealth(s)
+	}
+
 	feeds, err := s.db.GetFeeds(context.Background())
 	if err != nil {
 		return fmt.Errorf("Could not get feeds from DB: %v", err)
@@ -250,11 +346,55 @@ func handlerGetFeeds(s *state, cmd command) error {
 	return nil
 }
 
+func enableFeed(s *state, url string) error {
+	feed, err := getFeedByURL(context.Background(), s, url)
+	if err != nil {
+		return fmt.Errorf("Could not get feed using URL: %v from DB: %v", url, err)
+	}
+	if err := s.db.EnableFeed(context.Background(), feed.ID); err != nil {
+		return fmt.Errorf("Could not enable feed %v: %v", feed.Name, err)
+	}
+	fmt.Printf("Feed %v enabled\n", feed.Name)
+	return nil
+}
+
+func printFeedHealth(s *state) error {
+	feeds, err := s.db.GetUnhealthyFeeds(context.Background())
+	if err != nil {
+		return fmt.Errorf("Could not get feeds from DB: %v", err)
+	}
+	if len(feeds) == 0 {
+		fmt.Println("All feeds are healthy")
+		return nil
+	}
+	for _, feed := range feeds {
+		condition := "failing"
+		if feed.DisabledAt.Valid {
+			condition = "DISABLED since " + feed.DisabledAt.Time.Format(time.RFC1123)
+		}
+		fmt.Printf("Name: %v - URL: %v - %v\n", feed.Name, feed.Url, condition)
+		status := "none"
+		if feed.LastStatus.Valid {
+			status = strconv.Itoa(int(feed.LastStatus.Int32))
+		}
+		lastSuccess := "never"
+		if feed.LastSuccessAt.Valid {
+			lastSuccess = feed.LastSuccessAt.Time.Format(time.RFC1123)
+		}
+		fmt.Printf("    Failures in a row: %v - Last status: %v - Last success: %v\n", feed.ConsecutiveFailures, status, lastSuccess)
+		fmt.Printf("    Last error: %v\n", feed.LastError.String)
+	}
+	return nil
+}
+
 func handlerCreateFeedFollow(s *state, cmd command, user database.User) error {
 	if len(cmd.Args) != 1 {
 		return fmt.Errorf("Must provide (only) url")
 	}
-	feed, err := s.db.GetFeedByURL(context.Background(), cmd.Args[0])
+	feed, err := getFeedByURL(context.Background(), s, cmd.Args[0])
+	if errors.Is(err, sql.ErrNoRows) {
+		feed, err = discoverFollowedFeed(context.Background(), s, cmd.Args[0])
+	}
 	if err != nil {
 		return fmt.Errorf("Could not get feed using URL: %v from DB: %v", cmd.Args[0], err)
 	}
@@ -274,6 +414,43 @@ func handlerCreateFeedFollow(s *state, cmd command, user database.User) error {
 	return nil
 }
 
+// discoverFollowedFeed resolves a website URL given to follow to the one
+// feed it advertises that has already been added.
+func discoverFollowedFeed(ctx context.Context, s *state, pageURL string) (database.Feed, error) {
+	candidates, err := s.fetcher.discoverFeeds(ctx, pageURL)
+	if err != nil {
+		return database.Feed{}, err
+	}
+	var known []database.Feed
+	var unknown []string
+	for _, c := range candidates {
+		feed, err := getFeedByURL(ctx, s, c.URL)
+		switch {
+		case err == nil:
+			known = append(known, feed)
+		case errors.Is(err, sql.ErrNoRows):
+			unknown = append(unknown, c.URL)
+		default:
+			return database.Feed{}, err
+		}
+	}
+	switch {
+	case len(known) == 1:
+		fmt.Printf("Found feed: %v\n", known[0].Url)
+		return known[0], nil
+	case len(known) > 1:
+		urls := make([]feedCandidate, len(known))
+		for i, feed := range known {
+			urls[i] = feedCandidate{URL: feed.Url, Title: feed.Name}
+		}
+		_, err := chooseCandidate(pageURL, urls)
+		return database.Feed{}, err
+	case len(unknown) > 0:
+		return database.Feed{}, fmt.Errorf("Feed not added yet, add it with 'gator addfeed <name> <url>' using one of:\n\t%v", strings.Join(unknown, "\n\t"))
+	}
+	return database.Feed{}, sql.ErrNoRows
+}
+
 func handlerFeedFollowsForUser(s *state, cmd command, user database.User) error {
 	if len(cmd.Args) != 0 {
 		return fmt.Errorf("Only runs on current user")
@@ -297,7 +474,7 @@ func handlerUnfollowURL(s *state, cmd command, user database.User) error {
 	if len(cmd.Args) != 1 {
 		return fmt.Errorf("Must provide URL")
 	}
-	feed, err := s.db.GetFeedByURL(context.Background(), cmd.Args[0])
+	feed, err := getFeedByURL(context.Background(), s, cmd.Args[0])
 	if err != nil {
 		return fmt.Errorf("Could not get feeds for URL: %v from DB: %v", cmd.Args[0], err)
 	}
@@ -4,13 +4,145 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"time"
 )
 
 const configFileName = ".gatorconfig.json"
 
+const (
+	DefaultFetchMinInterval       = 15 * time.Minute
+	DefaultFetchMaxInterval       = 24 * time.Hour
+	DefaultMaxConsecutiveFailures = 10
+	DefaultHostRequestsPerMinute  = 30
+	DefaultFetchRetries           = 3
+	DefaultFetchConnectTimeout    = 10 * time.Second
+	DefaultFetchReadTimeout       = 30 * time.Second
+	DefaultFetchTotalTimeout      = 60 * time.Second
+	DefaultMaxFeedBytes           = 10 << 20
+	DefaultDownloadDir            = "gator-downloads"
+)
+
 type Config struct {
 	DbURL           string `json:"db_url"`
 	CurrentUserName string `json:"current_user_name"`
+	// Bounds for each feed's adaptive polling interval, as Go durations.
+	FetchMinInterval string `json:"fetch_min_interval,omitempty"`
+	FetchMaxInterval string `json:"fetch_max_interval,omitempty"`
+	// Feeds are disabled after this many failed fetches in a row.
+	MaxConsecutiveFailures int `json:"max_consecutive_failures,omitempty"`
+	// Requests per minute allowed to any single host.
+	HostRateLimit int `json:"host_requests_per_minute,omitempty"`
+	// Retries of a fetch that timed out or got a 5xx/429; -1 disables them.
+	Retries int `json:"fetch_retries,omitempty"`
+	// Per-request timeouts as Go durations: establishing the connection,
+	// waiting between reads, and the whole request including the body.
+	FetchConnectTimeout string `json:"fetch_connect_timeout,omitempty"`
+	FetchReadTimeout    string `json:"fetch_read_timeout,omitempty"`
+	FetchTotalTimeout   string `json:"fetch_total_timeout,omitempty"`
+	// Largest feed body that will be read, in bytes.
+	MaxFeedBytes int64 `json:"max_feed_bytes,omitempty"`
+	// Where downloaded enclosures are saved, one subdirectory per feed.
+	DownloadDir string `json:"download_dir,omitempty"`
+}
+
+// FetchTimeouts returns the connect, read and total request timeouts,
+// using the defaults for any that are unset.
+func (config *Config) FetchTimeouts() (connect, read, total time.Duration, err error) {
+	connect, err = parseDuration(config.FetchConnectTimeout, DefaultFetchConnectTimeout)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("Invalid fetch_connect_timeout: %v", err)
+	}
+	read, err = parseDuration(config.FetchReadTimeout, DefaultFetchReadTimeout)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("Invalid fetch_read_timeout: %v", err)
+	}
+	total, err = parseDuration(config.FetchTotalTimeout, DefaultFetchTotalTimeout)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("Invalid fetch_total_timeout: %v", err)
+	}
+	return connect, read, total, nil
+}
+
+// MaxFeedSize returns the body size limit, or the default when it is unset.
+func (config *Config) MaxFeedSize() int64 {
+	if config.MaxFeedBytes > 0 {
+		return config.MaxFeedBytes
+	}
+	return DefaultMaxFeedBytes
+}
+
+// Downloads returns the enclosure download directory, defaulting to
+// DefaultDownloadDir in the home directory.
+func (config *Config) Downloads() (string, error) {
+	if config.DownloadDir != "" {
+		return config.DownloadDir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("Could not get home dir: %v", err)
+	}
+	return filepath.Join(home, DefaultDownloadDir), nil
+}
+
+// MaxFeedFailures returns the configured failure limit, or the default
+// when it is unset.
+func (config *Config) MaxFeedFailures() int {
+	if config.MaxConsecutiveFailures > 0 {
+		return config.MaxConsecutiveFailures
+	}
+	return DefaultMaxConsecutiveFailures
+}
+
+// HostRequestsPerMinute returns the per-host rate limit, or the default
+// when it is unset.
+func (config *Config) HostRequestsPerMinute() int {
+	if config.HostRateLimit > 0 {
+		return config.HostRateLimit
+	}
+	return DefaultHostRequestsPerMinute
+}
+
+// FetchRetries returns how many times a transient failure is retried.
+func (config *Config) FetchRetries() int {
+	switch {
+	case config.Retries < 0:
+		return 0
+	case config.Retries == 0:
+		return DefaultFetchRetries
+	}
+	return config.Retries
+}
+
+// FetchIntervalBounds returns the configured polling bounds, using the
+// defaults for any that are unset.
+func (config *Config) FetchIntervalBounds() (time.Duration, time.Duration, error) {
+	minInterval, err := parseDuration(config.FetchMinInterval, DefaultFetchMinInterval)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Invalid fetch_min_interval: %v", err)
+	}
+	maxInterval, err := parseDuration(config.FetchMaxInterval, DefaultFetchMaxInterval)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Invalid fetch_max_interval: %v", err)
+	}
+	if minInterval > maxInterval {
+		return 0, 0, fmt.Errorf("fetch_min_interval (%v) is longer than fetch_max_interval (%v)", minInterval, maxInterval)
+	}
+	return minInterval, maxInterval, nil
+}
+
+func parseDuration(value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("must be positive, got %v", d)
+	}
+	return d, nil
 }
 
 func (config *Config) SetUser(user string) error {
@@ -7,31 +7,127 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const changeFeedURL = `-- name: ChangeFeedURL :exec
+UPDATE feeds
+SET url = $2,
+    canonical_url = $3,
+    updated_at = NOW(),
+    etag = NULL,
+    last_modified = NULL,
+    next_fetch_at = NULL,
+    last_status = NULL,
+    last_error = NULL,
+    consecutive_failures = 0,
+    disabled_at = NULL,
+    redirect_url = NULL,
+    redirect_count = 0
+WHERE id = $1
+`
+
+type ChangeFeedURLParams struct {
+	ID           uuid.UUID
+	Url          string
+	CanonicalUrl sql.NullString
+}
+
+// Forgets everything learned from fetching the old URL, so the feed is
+// fetched afresh on the next aggregator pass.
+func (q *Queries) ChangeFeedURL(ctx context.Context, arg ChangeFeedURLParams) error {
+	_, err := q.db.ExecContext(ctx, changeFeedURL, arg.ID, arg.Url, arg.CanonicalUrl)
+	return err
+}
+
+const claimNextFeedToFetch = `-- name: ClaimNextFeedToFetch :one
+UPDATE feeds
+SET updated_at = $1::TIMESTAMP,
+    last_fetched_at = $1::TIMESTAMP,
+    next_fetch_at = $1::TIMESTAMP + INTERVAL '10 minutes'
+WHERE id = (
+    SELECT id FROM feeds
+    WHERE disabled_at IS NULL
+        AND (next_fetch_at IS NULL OR next_fetch_at <= $1::TIMESTAMP)
+    ORDER BY next_fetch_at ASC NULLS FIRST, last_fetched_at ASC NULLS FIRST
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, next_fetch_at, last_status, last_error, consecutive_failures, last_success_at, disabled_at, redirect_url, redirect_count, canonical_url, site_url, description, language, image_url, generator
+`
+
+// The provisional next_fetch_at leases the feed to the claiming worker
+// until SetFeedNextFetch records the real schedule. now is the caller's UTC
+// time, the clock SetFeedNextFetch's schedule is written in, rather than
+// NOW() in the session's time zone.
+func (q *Queries) ClaimNextFeedToFetch(ctx context.Context, now time.Time) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, claimNextFeedToFetch, now)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.NextFetchAt,
+		&i.LastStatus,
+		&i.LastError,
+		&i.ConsecutiveFailures,
+		&i.LastSuccessAt,
+		&i.DisabledAt,
+		&i.RedirectUrl,
+		&i.RedirectCount,
+		&i.CanonicalUrl,
+		&i.SiteUrl,
+		&i.Description,
+		&i.Language,
+		&i.ImageUrl,
+		&i.Generator,
+	)
+	return i, err
+}
+
+const clearFeedRedirect = `-- name: ClearFeedRedirect :exec
+UPDATE feeds
+SET redirect_url = NULL,
+    redirect_count = 0
+WHERE id = $1
+`
+
+func (q *Queries) ClearFeedRedirect(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, clearFeedRedirect, id)
+	return err
+}
+
 const createFeed = `-- name: CreateFeed :one
-INSERT INTO feeds (id, created_at, updated_at, name, url, user_id)
+INSERT INTO feeds (id, created_at, updated_at, name, url, user_id, canonical_url)
 VALUES (
     $1,
     $2,
     $3,
     $4,
     $5,
-    $6
+    $6,
+    $7
 )
-RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, next_fetch_at, last_status, last_error, consecutive_failures, last_success_at, disabled_at, redirect_url, redirect_count, canonical_url, site_url, description, language, image_url, generator
 `
 
 type CreateFeedParams struct {
-	ID        uuid.UUID
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	Name      string
-	Url       string
-	UserID    uuid.UUID
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Name         string
+	Url          string
+	UserID       uuid.UUID
+	CanonicalUrl sql.NullString
 }
 
 func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, error) {
@@ -42,6 +138,7 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		arg.Name,
 		arg.Url,
 		arg.UserID,
+		arg.CanonicalUrl,
 	)
 	var i Feed
 	err := row.Scan(
@@ -52,10 +149,36 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.NextFetchAt,
+		&i.LastStatus,
+		&i.LastError,
+		&i.ConsecutiveFailures,
+		&i.LastSuccessAt,
+		&i.DisabledAt,
+		&i.RedirectUrl,
+		&i.RedirectCount,
+		&i.CanonicalUrl,
+		&i.SiteUrl,
+		&i.Description,
+		&i.Language,
+		&i.ImageUrl,
+		&i.Generator,
 	)
 	return i, err
 }
 
+const deleteFeed = `-- name: DeleteFeed :exec
+DELETE FROM feeds
+WHERE id = $1
+`
+
+func (q *Queries) DeleteFeed(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteFeed, id)
+	return err
+}
+
 const deleteFeeds = `-- name: DeleteFeeds :exec
 DELETE FROM feeds
 `
@@ -65,48 +188,32 @@ func (q *Queries) DeleteFeeds(ctx context.Context) error {
 	return err
 }
 
-const getFeedByName = `-- name: GetFeedByName :one
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
-WHERE name = $1
+const disableFeed = `-- name: DisableFeed :exec
+UPDATE feeds
+SET disabled_at = NOW()
+WHERE id = $1
 `
 
-func (q *Queries) GetFeedByName(ctx context.Context, name string) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, getFeedByName, name)
-	var i Feed
-	err := row.Scan(
-		&i.ID,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.Name,
-		&i.Url,
-		&i.UserID,
-		&i.LastFetchedAt,
-	)
-	return i, err
+func (q *Queries) DisableFeed(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, disableFeed, id)
+	return err
 }
 
-const getFeedByURL = `-- name: GetFeedByURL :one
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
-WHERE url = $1
+const enableFeed = `-- name: EnableFeed :exec
+UPDATE feeds
+SET disabled_at = NULL,
+    consecutive_failures = 0,
+    next_fetch_at = NULL
+WHERE id = $1
 `
 
-func (q *Queries) GetFeedByURL(ctx context.Context, url string) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, getFeedByURL, url)
-	var i Feed
-	err := row.Scan(
-		&i.ID,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.Name,
-		&i.Url,
-		&i.UserID,
-		&i.LastFetchedAt,
-	)
-	return i, err
+func (q *Queries) EnableFeed(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, enableFeed, id)
+	return err
 }
 
 const getFeeds = `-- name: GetFeeds :many
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, next_fetch_at, last_status, last_error, consecutive_failures, last_success_at, disabled_at, redirect_url, redirect_count, canonical_url, site_url, description, language, image_url, generator FROM feeds
 `
 
 func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
@@ -126,6 +233,22 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 			&i.Url,
 			&i.UserID,
 			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.NextFetchAt,
+			&i.LastStatus,
+			&i.LastError,
+			&i.ConsecutiveFailures,
+			&i.LastSuccessAt,
+			&i.DisabledAt,
+			&i.RedirectUrl,
+			&i.RedirectCount,
+			&i.CanonicalUrl,
+			&i.SiteUrl,
+			&i.Description,
+			&i.Language,
+			&i.ImageUrl,
+			&i.Generator,
 		); err != nil {
 			return nil, err
 		}
@@ -140,35 +263,392 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 	return items, nil
 }
 
-const getNextFeedToFetch = `-- name: GetNextFeedToFetch :one
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT 1
+const getFeedsByName = `-- name: GetFeedsByName :many
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, next_fetch_at, last_status, last_error, consecutive_failures, last_success_at, disabled_at, redirect_url, redirect_count, canonical_url, site_url, description, language, image_url, generator FROM feeds
+WHERE name = $1
+ORDER BY created_at
 `
 
-func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, getNextFeedToFetch)
-	var i Feed
-	err := row.Scan(
-		&i.ID,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.Name,
-		&i.Url,
-		&i.UserID,
-		&i.LastFetchedAt,
+// Names aren't unique, so this can return several feeds.
+func (q *Queries) GetFeedsByName(ctx context.Context, name string) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getFeedsByName, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.NextFetchAt,
+			&i.LastStatus,
+			&i.LastError,
+			&i.ConsecutiveFailures,
+			&i.LastSuccessAt,
+			&i.DisabledAt,
+			&i.RedirectUrl,
+			&i.RedirectCount,
+			&i.CanonicalUrl,
+			&i.SiteUrl,
+			&i.Description,
+			&i.Language,
+			&i.ImageUrl,
+			&i.Generator,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFeedsByURL = `-- name: GetFeedsByURL :many
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, next_fetch_at, last_status, last_error, consecutive_failures, last_success_at, disabled_at, redirect_url, redirect_count, canonical_url, site_url, description, language, image_url, generator FROM feeds
+WHERE url IN ($1, $2)
+    OR canonical_url = $3
+    OR id IN (
+        SELECT feed_id FROM feed_url_aliases
+        WHERE feed_url_aliases.url IN ($1, $2)
+    )
+ORDER BY created_at
+`
+
+type GetFeedsByURLParams struct {
+	Url          string
+	RawUrl       string
+	CanonicalUrl sql.NullString
+}
+
+// Matches the feed's current URL as given or normalized, its canonical form
+// or any URL it has moved away from. Until dedupe has run these can match
+// more than one feed.
+func (q *Queries) GetFeedsByURL(ctx context.Context, arg GetFeedsByURLParams) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getFeedsByURL, arg.Url, arg.RawUrl, arg.CanonicalUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.NextFetchAt,
+			&i.LastStatus,
+			&i.LastError,
+			&i.ConsecutiveFailures,
+			&i.LastSuccessAt,
+			&i.DisabledAt,
+			&i.RedirectUrl,
+			&i.RedirectCount,
+			&i.CanonicalUrl,
+			&i.SiteUrl,
+			&i.Description,
+			&i.Language,
+			&i.ImageUrl,
+			&i.Generator,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUnhealthyFeeds = `-- name: GetUnhealthyFeeds :many
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, next_fetch_at, last_status, last_error, consecutive_failures, last_success_at, disabled_at, redirect_url, redirect_count, canonical_url, site_url, description, language, image_url, generator FROM feeds
+WHERE consecutive_failures > 0 OR disabled_at IS NOT NULL
+ORDER BY disabled_at ASC NULLS LAST, consecutive_failures DESC
+`
+
+func (q *Queries) GetUnhealthyFeeds(ctx context.Context) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getUnhealthyFeeds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.NextFetchAt,
+			&i.LastStatus,
+			&i.LastError,
+			&i.ConsecutiveFailures,
+			&i.LastSuccessAt,
+			&i.DisabledAt,
+			&i.RedirectUrl,
+			&i.RedirectCount,
+			&i.CanonicalUrl,
+			&i.SiteUrl,
+			&i.Description,
+			&i.Language,
+			&i.ImageUrl,
+			&i.Generator,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const mergeFeedAliases = `-- name: MergeFeedAliases :exec
+WITH moved AS (
+    UPDATE feed_url_aliases
+    SET feed_id = $1
+    WHERE feed_id = $2
+)
+INSERT INTO feed_url_aliases (url, feed_id, created_at)
+VALUES ($3, $1, NOW())
+ON CONFLICT (url) DO NOTHING
+`
+
+type MergeFeedAliasesParams struct {
+	ToFeedID   uuid.UUID
+	FromFeedID uuid.UUID
+	Url        string
+}
+
+// Hands the source feed's aliases to the target and adds url, the source's
+// own URL, as another.
+func (q *Queries) MergeFeedAliases(ctx context.Context, arg MergeFeedAliasesParams) error {
+	_, err := q.db.ExecContext(ctx, mergeFeedAliases, arg.ToFeedID, arg.FromFeedID, arg.Url)
+	return err
+}
+
+const moveFeedURL = `-- name: MoveFeedURL :exec
+WITH old_url AS (
+    INSERT INTO feed_url_aliases (url, feed_id, created_at)
+    SELECT url, id, NOW() FROM feeds WHERE id = $1
+    ON CONFLICT (url) DO NOTHING
+), new_url AS (
+    DELETE FROM feed_url_aliases
+    WHERE feed_url_aliases.url = $2 AND feed_id = $1
+)
+UPDATE feeds
+SET url = $2,
+    canonical_url = $3,
+    updated_at = NOW(),
+    redirect_url = NULL,
+    redirect_count = 0
+WHERE id = $1
+`
+
+type MoveFeedURLParams struct {
+	ID           uuid.UUID
+	Url          string
+	CanonicalUrl sql.NullString
+}
+
+// The old URL is kept as an alias so lookups by it still find the feed.
+func (q *Queries) MoveFeedURL(ctx context.Context, arg MoveFeedURLParams) error {
+	_, err := q.db.ExecContext(ctx, moveFeedURL, arg.ID, arg.Url, arg.CanonicalUrl)
+	return err
+}
+
+const recordFeedFailure = `-- name: RecordFeedFailure :one
+UPDATE feeds
+SET last_status = $2,
+    last_error = $3,
+    consecutive_failures = consecutive_failures + 1
+WHERE id = $1
+RETURNING consecutive_failures
+`
+
+type RecordFeedFailureParams struct {
+	ID         uuid.UUID
+	LastStatus sql.NullInt32
+	LastError  sql.NullString
+}
+
+func (q *Queries) RecordFeedFailure(ctx context.Context, arg RecordFeedFailureParams) (int32, error) {
+	row := q.db.QueryRowContext(ctx, recordFeedFailure, arg.ID, arg.LastStatus, arg.LastError)
+	var consecutive_failures int32
+	err := row.Scan(&consecutive_failures)
+	return consecutive_failures, err
+}
+
+const recordFeedRedirect = `-- name: RecordFeedRedirect :one
+UPDATE feeds
+SET redirect_count = CASE WHEN redirect_url = $2 THEN redirect_count + 1 ELSE 1 END,
+    redirect_url = $2
+WHERE id = $1
+RETURNING redirect_count
+`
+
+type RecordFeedRedirectParams struct {
+	ID          uuid.UUID
+	RedirectUrl sql.NullString
+}
+
+func (q *Queries) RecordFeedRedirect(ctx context.Context, arg RecordFeedRedirectParams) (int32, error) {
+	row := q.db.QueryRowContext(ctx, recordFeedRedirect, arg.ID, arg.RedirectUrl)
+	var redirect_count int32
+	err := row.Scan(&redirect_count)
+	return redirect_count, err
+}
+
+const recordFeedSuccess = `-- name: RecordFeedSuccess :exec
+UPDATE feeds
+SET last_status = $2,
+    last_error = NULL,
+    consecutive_failures = 0,
+    last_success_at = NOW()
+WHERE id = $1
+`
+
+type RecordFeedSuccessParams struct {
+	ID         uuid.UUID
+	LastStatus sql.NullInt32
+}
+
+func (q *Queries) RecordFeedSuccess(ctx context.Context, arg RecordFeedSuccessParams) error {
+	_, err := q.db.ExecContext(ctx, recordFeedSuccess, arg.ID, arg.LastStatus)
+	return err
+}
+
+const renameFeed = `-- name: RenameFeed :exec
+UPDATE feeds
+SET name = $2,
+    updated_at = NOW()
+WHERE id = $1
+`
+
+type RenameFeedParams struct {
+	ID   uuid.UUID
+	Name string
+}
+
+func (q *Queries) RenameFeed(ctx context.Context, arg RenameFeedParams) error {
+	_, err := q.db.ExecContext(ctx, renameFeed, arg.ID, arg.Name)
+	return err
+}
+
+const setFeedCacheHeaders = `-- name: SetFeedCacheHeaders :exec
+UPDATE feeds
+SET etag = $2,
+    last_modified = $3
+WHERE id = $1
+`
+
+type SetFeedCacheHeadersParams struct {
+	ID           uuid.UUID
+	Etag         sql.NullString
+	LastModified sql.NullString
+}
+
+func (q *Queries) SetFeedCacheHeaders(ctx context.Context, arg SetFeedCacheHeadersParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedCacheHeaders, arg.ID, arg.Etag, arg.LastModified)
+	return err
+}
+
+const setFeedMetadata = `-- name: SetFeedMetadata :exec
+UPDATE feeds
+SET site_url = $2,
+    description = $3,
+    language = $4,
+    image_url = $5,
+    generator = $6
+WHERE id = $1
+`
+
+type SetFeedMetadataParams struct {
+	ID          uuid.UUID
+	SiteUrl     sql.NullString
+	Description sql.NullString
+	Language    sql.NullString
+	ImageUrl    sql.NullString
+	Generator   sql.NullString
+}
+
+func (q *Queries) SetFeedMetadata(ctx context.Context, arg SetFeedMetadataParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedMetadata,
+		arg.ID,
+		arg.SiteUrl,
+		arg.Description,
+		arg.Language,
+		arg.ImageUrl,
+		arg.Generator,
 	)
-	return i, err
+	return err
 }
 
-const markFeedFetched = `-- name: MarkFeedFetched :exec
+const setFeedNextFetch = `-- name: SetFeedNextFetch :exec
 UPDATE feeds
-SET updated_at = NOW(),
-    last_fetched_at = NOW()
+SET next_fetch_at = $2
 WHERE id = $1
 `
 
-func (q *Queries) MarkFeedFetched(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, markFeedFetched, id)
+type SetFeedNextFetchParams struct {
+	ID          uuid.UUID
+	NextFetchAt sql.NullTime
+}
+
+func (q *Queries) SetFeedNextFetch(ctx context.Context, arg SetFeedNextFetchParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedNextFetch, arg.ID, arg.NextFetchAt)
+	return err
+}
+
+const setFeedURL = `-- name: SetFeedURL :exec
+UPDATE feeds
+SET url = $2,
+    canonical_url = $3,
+    updated_at = NOW()
+WHERE id = $1
+`
+
+type SetFeedURLParams struct {
+	ID           uuid.UUID
+	Url          string
+	CanonicalUrl sql.NullString
+}
+
+func (q *Queries) SetFeedURL(ctx context.Context, arg SetFeedURLParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedURL, arg.ID, arg.Url, arg.CanonicalUrl)
 	return err
 }
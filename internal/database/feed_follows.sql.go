@@ -12,6 +12,18 @@ import (
 	"github.com/google/uuid"
 )
 
+const countFeedFollows = `-- name: CountFeedFollows :one
+SELECT COUNT(*) FROM feed_follows
+WHERE feed_id = $1
+`
+
+func (q *Queries) CountFeedFollows(ctx context.Context, feedID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countFeedFollows, feedID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createFeedFollow = `-- name: CreateFeedFollow :one
 WITH inserted_feed_follows AS (
     INSERT INTO feed_follows (id, created_at, updated_at, user_id, feed_id)
@@ -145,3 +157,23 @@ func (q *Queries) GetFeedFollowsForUser(ctx context.Context, userID uuid.UUID) (
 	}
 	return items, nil
 }
+
+const moveFeedFollows = `-- name: MoveFeedFollows :exec
+UPDATE feed_follows
+SET feed_id = $1,
+    updated_at = NOW()
+WHERE feed_id = $2
+    AND user_id NOT IN (SELECT user_id FROM feed_follows WHERE feed_id = $1)
+`
+
+type MoveFeedFollowsParams struct {
+	ToFeedID   uuid.UUID
+	FromFeedID uuid.UUID
+}
+
+// Users already following the target feed keep that follow; their follow
+// of the source feed is left to be deleted with it.
+func (q *Queries) MoveFeedFollows(ctx context.Context, arg MoveFeedFollowsParams) error {
+	_, err := q.db.ExecContext(ctx, moveFeedFollows, arg.ToFeedID, arg.FromFeedID)
+	return err
+}
@@ -11,14 +11,40 @@ import (
 	"github.com/google/uuid"
 )
 
+type Enclosure struct {
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	PostID          uuid.UUID
+	Url             string
+	MimeType        sql.NullString
+	Length          sql.NullInt64
+	DurationSeconds sql.NullInt32
+}
+
 type Feed struct {
-	ID            uuid.UUID
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	Name          string
-	Url           string
-	UserID        uuid.UUID
-	LastFetchedAt sql.NullTime
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Name                string
+	Url                 string
+	UserID              uuid.UUID
+	LastFetchedAt       sql.NullTime
+	Etag                sql.NullString
+	LastModified        sql.NullString
+	NextFetchAt         sql.NullTime
+	LastStatus          sql.NullInt32
+	LastError           sql.NullString
+	ConsecutiveFailures int32
+	LastSuccessAt       sql.NullTime
+	DisabledAt          sql.NullTime
+	RedirectUrl         sql.NullString
+	RedirectCount       int32
+	CanonicalUrl        sql.NullString
+	SiteUrl             sql.NullString
+	Description         sql.NullString
+	Language            sql.NullString
+	ImageUrl            sql.NullString
+	Generator           sql.NullString
 }
 
 type FeedFollow struct {
@@ -29,15 +55,27 @@ type FeedFollow struct {
 	FeedID    uuid.UUID
 }
 
+type FeedUrlAlias struct {
+	Url       string
+	FeedID    uuid.UUID
+	CreatedAt time.Time
+}
+
 type Post struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Title       string
-	Url         string
-	Description sql.NullString
-	PublishedAt sql.NullTime
-	FeedID      uuid.UUID
+	ID                uuid.UUID
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	Title             string
+	Url               string
+	Description       sql.NullString
+	PublishedAt       time.Time
+	FeedID            uuid.NullUUID
+	PublishedAtSource string
+	Guid              string
+	Author            sql.NullString
+	Categories        []string
+	Content           sql.NullString
+	CommentsUrl       sql.NullString
 }
 
 type User struct {
@@ -45,4 +83,13 @@ type User struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Name      string
+	IsAdmin   bool
+}
+
+type UserPostState struct {
+	UserID    uuid.UUID
+	PostID    uuid.UUID
+	Read      bool
+	ReadAt    sql.NullTime
+	StarredAt sql.NullTime
 }
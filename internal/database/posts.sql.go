@@ -11,35 +11,43 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
-const createPost = `-- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id
+const adoptLegacyPost = `-- name: AdoptLegacyPost :one
+UPDATE posts
+SET guid = $1
+WHERE id = (
+    SELECT legacy.id FROM posts AS legacy
+    WHERE legacy.feed_id = $2
+        AND legacy.url IN ($3, $4)
+        AND legacy.guid = encode(sha256(convert_to(legacy.url || E'\n' || legacy.title, 'UTF8')), 'hex')
+    ORDER BY legacy.created_at
+    LIMIT 1
+)
+    AND NOT EXISTS (
+        SELECT 1 FROM posts AS existing
+        WHERE existing.feed_id = $2 AND existing.guid = $1
+    )
+RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id, published_at_source, guid, author, categories, content, comments_url
 `
 
-type CreatePostParams struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Title       string
-	Url         string
-	Description sql.NullString
-	PublishedAt sql.NullTime
-	FeedID      uuid.UUID
+type AdoptLegacyPostParams struct {
+	Guid   string
+	FeedID uuid.NullUUID
+	Url    string
+	Link   string
 }
 
-func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, error) {
-	row := q.db.QueryRowContext(ctx, createPost,
-		arg.ID,
-		arg.CreatedAt,
-		arg.UpdatedAt,
-		arg.Title,
-		arg.Url,
-		arg.Description,
-		arg.PublishedAt,
+// Posts stored before guids were tracked got a hash of their URL and title
+// as guid. When an item with a real guid is first stored, the copy stored
+// before gets that guid instead, so it is updated from then on.
+func (q *Queries) AdoptLegacyPost(ctx context.Context, arg AdoptLegacyPostParams) (Post, error) {
+	row := q.db.QueryRowContext(ctx, adoptLegacyPost,
+		arg.Guid,
 		arg.FeedID,
+		arg.Url,
+		arg.Link,
 	)
 	var i Post
 	err := row.Scan(
@@ -51,39 +59,173 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, e
 		&i.Description,
 		&i.PublishedAt,
 		&i.FeedID,
+		&i.PublishedAtSource,
+		&i.Guid,
+		&i.Author,
+		pq.Array(&i.Categories),
+		&i.Content,
+		&i.CommentsUrl,
 	)
 	return i, err
 }
 
+const countFeedPosts = `-- name: CountFeedPosts :one
+SELECT COUNT(*) FROM posts
+WHERE feed_id = $1
+`
+
+func (q *Queries) CountFeedPosts(ctx context.Context, feedID uuid.NullUUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countFeedPosts, feedID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const deleteOrphanedPosts = `-- name: DeleteOrphanedPosts :execrows
+DELETE FROM posts
+WHERE feed_id IS NULL
+    AND NOT EXISTS (
+        SELECT 1 FROM user_post_states
+        WHERE user_post_states.post_id = posts.id AND user_post_states.starred_at IS NOT NULL
+    )
+`
+
+// Posts kept from a deleted feed go once nobody has them starred.
+func (q *Queries) DeleteOrphanedPosts(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteOrphanedPosts)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deletePost = `-- name: DeletePost :exec
+DELETE FROM posts
+WHERE id = $1
+`
+
+func (q *Queries) DeletePost(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deletePost, id)
+	return err
+}
+
+const deleteUnstarredFeedPosts = `-- name: DeleteUnstarredFeedPosts :execrows
+DELETE FROM posts
+WHERE feed_id = $1
+    AND NOT EXISTS (
+        SELECT 1 FROM user_post_states
+        WHERE user_post_states.post_id = posts.id AND user_post_states.starred_at IS NOT NULL
+    )
+`
+
+// Run before DeleteFeed, which keeps the starred posts without a feed.
+func (q *Queries) DeleteUnstarredFeedPosts(ctx context.Context, feedID uuid.NullUUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUnstarredFeedPosts, feedID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getPostsForUser = `-- name: GetPostsForUser :many
 
-SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, feeds.name AS feed_name FROM posts
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.published_at_source, posts.guid, posts.author, posts.categories, posts.content, posts.comments_url, feeds.name AS feed_name, COALESCE(user_post_states.read, FALSE) AS read, user_post_states.starred_at IS NOT NULL AS starred FROM posts
 JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
 JOIN feeds ON posts.feed_id = feeds.id
+LEFT JOIN user_post_states ON user_post_states.post_id = posts.id
+    AND user_post_states.user_id = feed_follows.user_id
 WHERE feed_follows.user_id = $1
-ORDER BY posts.published_at DESC
-LIMIT $2
+    AND ($2::TEXT = 'all' OR COALESCE(user_post_states.read, FALSE) = ($2::TEXT = 'read'))
+    AND ($3::UUID IS NULL OR posts.feed_id = $3)
+    AND ($4::TIMESTAMP IS NULL OR posts.published_at >= $4)
+    AND ($5::TIMESTAMP IS NULL OR posts.published_at < $5)
+    AND (
+        $6::TEXT IS NULL
+        OR posts.title ILIKE '%' || $6 || '%'
+        OR posts.description ILIKE '%' || $6 || '%'
+    )
+    AND ($7::TEXT IS NULL OR posts.author ILIKE '%' || $7 || '%')
+    AND (
+        $8::TIMESTAMP IS NULL
+        OR (
+            $9::BOOLEAN
+            AND (CASE WHEN $10::TEXT = 'fetched' THEN posts.created_at ELSE posts.published_at END, posts.id)
+                < ($8, $11::UUID)
+        )
+        OR (
+            NOT $9::BOOLEAN
+            AND (CASE WHEN $10::TEXT = 'fetched' THEN posts.created_at ELSE posts.published_at END, posts.id)
+                > ($8, $11::UUID)
+        )
+    )
+ORDER BY
+    CASE WHEN $10::TEXT = 'feed' AND NOT $9::BOOLEAN THEN feeds.name END ASC,
+    CASE WHEN $10::TEXT = 'feed' AND $9::BOOLEAN THEN feeds.name END DESC,
+    CASE WHEN $10::TEXT <> 'feed' AND NOT $9::BOOLEAN
+        THEN CASE WHEN $10::TEXT = 'fetched' THEN posts.created_at ELSE posts.published_at END
+    END ASC,
+    CASE WHEN $10::TEXT <> 'feed' AND NOT $9::BOOLEAN THEN posts.id END ASC,
+    CASE WHEN $10::TEXT = 'fetched' THEN posts.created_at ELSE posts.published_at END DESC,
+    posts.id DESC
+LIMIT $12
+OFFSET $13
 `
 
 type GetPostsForUserParams struct {
-	UserID uuid.UUID
-	Limit  int32
+	UserID        uuid.UUID
+	ReadState     string
+	FeedID        uuid.NullUUID
+	Since         sql.NullTime
+	Until         sql.NullTime
+	Keyword       sql.NullString
+	Author        sql.NullString
+	CursorSortKey sql.NullTime
+	SortDesc      bool
+	SortBy        string
+	CursorID      uuid.NullUUID
+	PostLimit     int32
+	PostOffset    int32
 }
 
 type GetPostsForUserRow struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Title       string
-	Url         string
-	Description sql.NullString
-	PublishedAt sql.NullTime
-	FeedID      uuid.UUID
-	FeedName    string
+	ID                uuid.UUID
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	Title             string
+	Url               string
+	Description       sql.NullString
+	PublishedAt       time.Time
+	FeedID            uuid.NullUUID
+	PublishedAtSource string
+	Guid              string
+	Author            sql.NullString
+	Categories        []string
+	Content           sql.NullString
+	CommentsUrl       sql.NullString
+	FeedName          string
+	Read              bool
+	Starred           bool
 }
 
+// Every filter is skipped when its argument is NULL. Pages either by offset
+// or, stably while new posts arrive, by a keyset cursor: the sort key and id
+// of the last post already seen. Sorting by feed name only supports offsets.
 func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams) ([]GetPostsForUserRow, error) {
-	rows, err := q.db.QueryContext(ctx, getPostsForUser, arg.UserID, arg.Limit)
+	rows, err := q.db.QueryContext(ctx, getPostsForUser,
+		arg.UserID,
+		arg.ReadState,
+		arg.FeedID,
+		arg.Since,
+		arg.Until,
+		arg.Keyword,
+		arg.Author,
+		arg.CursorSortKey,
+		arg.SortDesc,
+		arg.SortBy,
+		arg.CursorID,
+		arg.PostLimit,
+		arg.PostOffset,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -100,7 +242,15 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 			&i.Description,
 			&i.PublishedAt,
 			&i.FeedID,
+			&i.PublishedAtSource,
+			&i.Guid,
+			&i.Author,
+			pq.Array(&i.Categories),
+			&i.Content,
+			&i.CommentsUrl,
 			&i.FeedName,
+			&i.Read,
+			&i.Starred,
 		); err != nil {
 			return nil, err
 		}
@@ -114,3 +264,137 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 	}
 	return items, nil
 }
+
+const getRecentPostTimesForFeed = `-- name: GetRecentPostTimesForFeed :many
+
+SELECT published_at FROM posts
+WHERE feed_id = $1 AND published_at_source <> 'first_seen'
+ORDER BY published_at DESC
+LIMIT $2
+`
+
+type GetRecentPostTimesForFeedParams struct {
+	FeedID uuid.NullUUID
+	Limit  int32
+}
+
+func (q *Queries) GetRecentPostTimesForFeed(ctx context.Context, arg GetRecentPostTimesForFeedParams) ([]time.Time, error) {
+	rows, err := q.db.QueryContext(ctx, getRecentPostTimesForFeed, arg.FeedID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []time.Time
+	for rows.Next() {
+		var published_at time.Time
+		if err := rows.Scan(&published_at); err != nil {
+			return nil, err
+		}
+		items = append(items, published_at)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const movePosts = `-- name: MovePosts :exec
+UPDATE posts
+SET feed_id = $1
+WHERE feed_id = $2
+    AND guid NOT IN (SELECT guid FROM posts WHERE feed_id = $1)
+`
+
+type MovePostsParams struct {
+	ToFeedID   uuid.NullUUID
+	FromFeedID uuid.NullUUID
+}
+
+// Posts the target feed already has are left to be deleted with the source.
+func (q *Queries) MovePosts(ctx context.Context, arg MovePostsParams) error {
+	_, err := q.db.ExecContext(ctx, movePosts, arg.ToFeedID, arg.FromFeedID)
+	return err
+}
+
+const upsertPost = `-- name: UpsertPost :one
+INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id, published_at_source, guid, author, categories, content, comments_url)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+ON CONFLICT (feed_id, guid) DO UPDATE
+SET title = EXCLUDED.title,
+    url = EXCLUDED.url,
+    description = EXCLUDED.description,
+    author = EXCLUDED.author,
+    categories = EXCLUDED.categories,
+    content = EXCLUDED.content,
+    comments_url = EXCLUDED.comments_url,
+    updated_at = CASE
+        WHEN posts.title IS DISTINCT FROM EXCLUDED.title
+            OR posts.url IS DISTINCT FROM EXCLUDED.url
+            OR posts.description IS DISTINCT FROM EXCLUDED.description
+            OR posts.content IS DISTINCT FROM EXCLUDED.content
+        THEN EXCLUDED.updated_at
+        ELSE posts.updated_at
+    END
+WHERE (posts.title, posts.url, posts.description, posts.author, posts.categories, posts.content, posts.comments_url)
+    IS DISTINCT FROM (EXCLUDED.title, EXCLUDED.url, EXCLUDED.description, EXCLUDED.author, EXCLUDED.categories, EXCLUDED.content, EXCLUDED.comments_url)
+RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id, published_at_source, guid, author, categories, content, comments_url
+`
+
+type UpsertPostParams struct {
+	ID                uuid.UUID
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	Title             string
+	Url               string
+	Description       sql.NullString
+	PublishedAt       time.Time
+	FeedID            uuid.NullUUID
+	PublishedAtSource string
+	Guid              string
+	Author            sql.NullString
+	Categories        []string
+	Content           sql.NullString
+	CommentsUrl       sql.NullString
+}
+
+// Returns no row when the post is already stored unchanged, so refetching a
+// feed doesn't rewrite every post in it.
+func (q *Queries) UpsertPost(ctx context.Context, arg UpsertPostParams) (Post, error) {
+	row := q.db.QueryRowContext(ctx, upsertPost,
+		arg.ID,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+		arg.Title,
+		arg.Url,
+		arg.Description,
+		arg.PublishedAt,
+		arg.FeedID,
+		arg.PublishedAtSource,
+		arg.Guid,
+		arg.Author,
+		pq.Array(arg.Categories),
+		arg.Content,
+		arg.CommentsUrl,
+	)
+	var i Post
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Title,
+		&i.Url,
+		&i.Description,
+		&i.PublishedAt,
+		&i.FeedID,
+		&i.PublishedAtSource,
+		&i.Guid,
+		&i.Author,
+		pq.Array(&i.Categories),
+		&i.Content,
+		&i.CommentsUrl,
+	)
+	return i, err
+}
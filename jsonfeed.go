@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type JSONFeed struct {
+	Version     string `json:"version"`
+	Title       string `json:"title"`
+	HomePageURL string `json:"home_page_url"`
+	Description string `json:"description"`
+	Language    string `json:"language"`
+	Icon        string `json:"icon"`
+	Favicon     string `json:"favicon"`
+	// Version 1.0 had a single author, 1.1 a list.
+	Author  *JSONFeedAuthor  `json:"author"`
+	Authors []JSONFeedAuthor `json:"authors"`
+	Items   []JSONFeedItem   `json:"items"`
+}
+
+type JSONFeedItem struct {
+	ID            json.RawMessage  `json:"id"`
+	URL           string           `json:"url"`
+	ExternalURL   string           `json:"external_url"`
+	Title         string           `json:"title"`
+	Summary       string           `json:"summary"`
+	ContentHTML   string           `json:"content_html"`
+	ContentText   string           `json:"content_text"`
+	DatePublished string           `json:"date_published"`
+	DateModified  string           `json:"date_modified"`
+	Author        *JSONFeedAuthor  `json:"author"`
+	Authors       []JSONFeedAuthor `json:"authors"`
+	Tags          []string         `json:"tags"`
+	Attachments   []struct {
+		URL               string  `json:"url"`
+		MimeType          string  `json:"mime_type"`
+		SizeInBytes       int64   `json:"size_in_bytes"`
+		DurationInSeconds float64 `json:"duration_in_seconds"`
+	} `json:"attachments"`
+}
+
+type JSONFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+func parseJSONFeed(data []byte) (*RSSFeed, error) {
+	var jf JSONFeed
+	if err := json.Unmarshal(bytes.TrimPrefix(data, utf8BOM), &jf); err != nil {
+		return nil, fmt.Errorf("Could not Unmarshal JSON Feed: %v", err)
+	}
+	if !strings.HasPrefix(jf.Version, "https://jsonfeed.org/version/") {
+		return nil, fmt.Errorf("Unsupported JSON Feed version: %q", jf.Version)
+	}
+
+	var feed RSSFeed
+	feed.Format = "JSON Feed " + strings.TrimPrefix(jf.Version, "https://jsonfeed.org/version/")
+	feed.Channel.Title = strings.TrimSpace(jf.Title)
+	feed.Channel.Link = strings.TrimSpace(jf.HomePageURL)
+	feed.Channel.Description = strings.TrimSpace(jf.Description)
+	feed.Channel.Language = strings.TrimSpace(jf.Language)
+	feed.Channel.Image = strings.TrimSpace(jf.Icon)
+	if feed.Channel.Image == "" {
+		feed.Channel.Image = strings.TrimSpace(jf.Favicon)
+	}
+	feedAuthor := jsonFeedAuthors(jf.Author, jf.Authors)
+
+	for _, item := range jf.Items {
+		link := item.URL
+		if link == "" {
+			link = item.ExternalURL
+		}
+		content := item.ContentHTML
+		if content == "" {
+			content = item.ContentText
+		}
+		description := item.Summary
+		if description == "" {
+			description = content
+		}
+		var enclosures []Enclosure
+		for _, a := range item.Attachments {
+			enclosures = append(enclosures, Enclosure{
+				URL:      a.URL,
+				Type:     a.MimeType,
+				Length:   max(a.SizeInBytes, 0),
+				Duration: max(int(a.DurationInSeconds), 0),
+			})
+		}
+		author := jsonFeedAuthors(item.Author, item.Authors)
+		if author == "" {
+			author = feedAuthor
+		}
+		feed.Channel.Item = append(feed.Channel.Item, RSSItem{
+			Title:       strings.TrimSpace(item.Title),
+			Link:        strings.TrimSpace(link),
+			Description: strings.TrimSpace(description),
+			PubDate:     strings.TrimSpace(item.DatePublished),
+			Updated:     strings.TrimSpace(item.DateModified),
+			GUID:        jsonFeedID(item.ID),
+			Author:      author,
+			Categories:  item.Tags,
+			Content:     strings.TrimSpace(content),
+			Enclosures:  cleanEnclosures(enclosures),
+		})
+	}
+	return &feed, nil
+}
+
+func jsonFeedAuthors(author *JSONFeedAuthor, authors []JSONFeedAuthor) string {
+	if len(authors) == 0 && author != nil {
+		authors = []JSONFeedAuthor{*author}
+	}
+	var names []string
+	for _, a := range authors {
+		if name := strings.TrimSpace(a.Name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// jsonFeedID returns the item id as a string; version 1.0 allowed
+// numeric ids, which 1.1 later required to be strings.
+func jsonFeedID(raw json.RawMessage) string {
+	var id string
+	if err := json.Unmarshal(raw, &id); err == nil {
+		return strings.TrimSpace(id)
+	}
+	return strings.TrimSpace(string(raw))
+}
@@ -12,7 +12,9 @@ import (
 
 type state struct {
 	db *database.Queries
+	dbConn *sql.DB
 	cfg *config.Config
+	fetcher *fetcher
 }
 
 type command struct {
@@ -34,8 +36,14 @@ func main() {
 	}
 	
 	dbQueries := database.New(db)
+
+	feedFetcher, err := newFetcher(&conf)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 	
-	cState := state{cfg: &conf, db: dbQueries}
+	cState := state{cfg: &conf, db: dbQueries, dbConn: db, fetcher: feedFetcher}
 	cCommands := commands{Command: make(map[string]func(*state, command) error)}
 
 	// REGISTER COMMANDS
@@ -46,10 +54,18 @@ func main() {
 	cCommands.register("agg", handlerAgg)
 	cCommands.register("addfeed", middlewareLoggedIn(handlerAddFeed))
 	cCommands.register("feeds", handlerGetFeeds)
+	cCommands.register("feed", middlewareLoggedIn(handlerFeed))
+	cCommands.register("dedupe", middlewareLoggedIn(handlerDedupeFeeds))
 	cCommands.register("follow", middlewareLoggedIn(handlerCreateFeedFollow))
 	cCommands.register("following", middlewareLoggedIn(handlerFeedFollowsForUser))
 	cCommands.register("unfollow", middlewareLoggedIn(handlerUnfollowURL))
 	cCommands.register("browse", middlewareLoggedIn(handlerBrowse))
+	cCommands.register("read", middlewareLoggedIn(handlerRead))
+	cCommands.register("unread", middlewareLoggedIn(handlerUnread))
+	cCommands.register("star", middlewareLoggedIn(handlerStar))
+	cCommands.register("unstar", middlewareLoggedIn(handlerUnstar))
+	cCommands.register("starred", middlewareLoggedIn(handlerStarred))
+	cCommands.register("enclosures", handlerEnclosures)
 
 	// -----------------
 	if len(os.Args) < 2 {
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"mime"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Enclosure is a media file attached to an item: a podcast episode, a video
+// or a thumbnail. Length is in bytes and Duration in seconds, both 0 when
+// unknown.
+type Enclosure struct {
+	URL      string
+	Type     string
+	Length   int64
+	Duration int
+}
+
+// rssMedia holds an RSS item's <enclosure>, Media RSS and iTunes elements.
+// It is embedded ahead of RSSItem's own fields because encoding/xml hands an
+// element to the first field matching its local name, and a plain
+// `xml:"description"` would otherwise swallow <media:description>.
+type rssMedia struct {
+	MediaTitle       string           `xml:"http://search.yahoo.com/mrss/ title"`
+	MediaDescription string           `xml:"http://search.yahoo.com/mrss/ description"`
+	MediaContent     []mediaContent   `xml:"http://search.yahoo.com/mrss/ content"`
+	MediaThumbnail   []mediaThumbnail `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+	MediaGroup       []mediaGroup     `xml:"http://search.yahoo.com/mrss/ group"`
+	ITunesAuthor     string           `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd author"`
+	ITunesSummary    string           `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd summary"`
+	ITunesSubtitle   string           `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd subtitle"`
+	ITunesDuration   string           `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+	RSSEnclosure     []rssEnclosure   `xml:"enclosure"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+type mediaContent struct {
+	URL      string `xml:"url,attr"`
+	Type     string `xml:"type,attr"`
+	FileSize string `xml:"fileSize,attr"`
+	Duration string `xml:"duration,attr"`
+}
+
+type mediaThumbnail struct {
+	URL string `xml:"url,attr"`
+}
+
+// mediaGroup bundles alternative renditions of one piece of media, as
+// YouTube's Atom feeds do for every entry.
+type mediaGroup struct {
+	Description string           `xml:"http://search.yahoo.com/mrss/ description"`
+	Content     []mediaContent   `xml:"http://search.yahoo.com/mrss/ content"`
+	Thumbnail   []mediaThumbnail `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+}
+
+// summary returns the first media or iTunes description present, for
+// items whose <description> is empty, as is common in podcasts.
+func (m rssMedia) summary() string {
+	candidates := []string{m.ITunesSummary, m.ITunesSubtitle, m.MediaDescription}
+	for _, group := range m.MediaGroup {
+		candidates = append(candidates, group.Description)
+	}
+	for _, candidate := range candidates {
+		if candidate = strings.TrimSpace(candidate); candidate != "" {
+			return candidate
+		}
+	}
+	return ""
+}
+
+func (m rssMedia) enclosures() []Enclosure {
+	var enclosures []Enclosure
+	for _, e := range m.RSSEnclosure {
+		enclosures = append(enclosures, Enclosure{URL: e.URL, Type: e.Type, Length: parseLength(e.Length)})
+	}
+	contents, thumbnails := m.MediaContent, m.MediaThumbnail
+	for _, group := range m.MediaGroup {
+		contents = append(contents, group.Content...)
+		thumbnails = append(thumbnails, group.Thumbnail...)
+	}
+	enclosures = append(enclosures, mediaEnclosures(contents, thumbnails)...)
+
+	// iTunes gives the episode's duration separately from its enclosure.
+	if duration := parseMediaDuration(m.ITunesDuration); duration > 0 {
+		for i := range enclosures {
+			if enclosures[i].Duration == 0 && isPlayable(enclosures[i].Type) {
+				enclosures[i].Duration = duration
+				break
+			}
+		}
+	}
+	return cleanEnclosures(enclosures)
+}
+
+func mediaEnclosures(contents []mediaContent, thumbnails []mediaThumbnail) []Enclosure {
+	var enclosures []Enclosure
+	for _, c := range contents {
+		enclosures = append(enclosures, Enclosure{
+			URL:      c.URL,
+			Type:     c.Type,
+			Length:   parseLength(c.FileSize),
+			Duration: parseMediaDuration(c.Duration),
+		})
+	}
+	for _, t := range thumbnails {
+		enclosures = append(enclosures, Enclosure{URL: t.URL})
+	}
+	return enclosures
+}
+
+// cleanEnclosures drops enclosures without a URL or repeating an earlier
+// one, and guesses missing types from the file extension.
+func cleanEnclosures(enclosures []Enclosure) []Enclosure {
+	var cleaned []Enclosure
+	seen := map[string]bool{}
+	for _, e := range enclosures {
+		e.URL = normalizeURL(e.URL)
+		if e.URL == "" || seen[e.URL] {
+			continue
+		}
+		seen[e.URL] = true
+		e.Type = strings.TrimSpace(e.Type)
+		if u, err := url.Parse(e.URL); err == nil && e.Type == "" {
+			e.Type, _, _ = strings.Cut(mime.TypeByExtension(path.Ext(u.Path)), ";")
+		}
+		cleaned = append(cleaned, e)
+	}
+	return cleaned
+}
+
+func isPlayable(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "audio/") || strings.HasPrefix(mimeType, "video/")
+}
+
+func parseLength(s string) int64 {
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// parseMediaDuration parses seconds, MM:SS or HH:MM:SS, ignoring any
+// fraction of a second.
+func parseMediaDuration(s string) int {
+	s, _, _ = strings.Cut(strings.TrimSpace(s), ".")
+	if s == "" {
+		return 0
+	}
+	seconds := 0
+	for _, part := range strings.Split(s, ":") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return 0
+		}
+		seconds = seconds*60 + n
+	}
+	return seconds
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RDFFeed is RSS 1.0, where items are siblings of the channel rather
+// than children of it.
+type RDFFeed struct {
+	Channel struct {
+		Title       string `xml:"title"`
+		Link        string `xml:"link"`
+		Description string `xml:"description"`
+		Language    string `xml:"http://purl.org/dc/elements/1.1/ language"`
+	} `xml:"channel"`
+	Image string    `xml:"image>url"`
+	Item  []RDFItem `xml:"item"`
+}
+
+type RDFItem struct {
+	About       string   `xml:"about,attr"`
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description"`
+	Date        string   `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Creator     string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Subject     []string `xml:"http://purl.org/dc/elements/1.1/ subject"`
+	Content     string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+}
+
+func parseRDF(data []byte) (*RSSFeed, error) {
+	var rdf RDFFeed
+	if err := newXMLDecoder(data).Decode(&rdf); err != nil {
+		return nil, fmt.Errorf("Could not Unmarshal RDF: %v", err)
+	}
+
+	var feed RSSFeed
+	feed.Format = "RSS 1.0 (RDF)"
+	feed.Channel.Title = strings.TrimSpace(rdf.Channel.Title)
+	feed.Channel.Link = strings.TrimSpace(rdf.Channel.Link)
+	feed.Channel.Description = strings.TrimSpace(rdf.Channel.Description)
+	feed.Channel.Language = strings.TrimSpace(rdf.Channel.Language)
+	feed.Channel.Image = strings.TrimSpace(rdf.Image)
+
+	for _, item := range rdf.Item {
+		feed.Channel.Item = append(feed.Channel.Item, RSSItem{
+			Title:       strings.TrimSpace(item.Title),
+			Link:        strings.TrimSpace(item.Link),
+			Description: strings.TrimSpace(item.Description),
+			PubDate:     strings.TrimSpace(item.Date),
+			GUID:        strings.TrimSpace(item.About),
+			Author:      strings.TrimSpace(item.Creator),
+			Categories:  item.Subject,
+			Content:     strings.TrimSpace(item.Content),
+		})
+	}
+	return &feed, nil
+}
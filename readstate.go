@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/AkuPython/Gator/internal/database"
+	"github.com/google/uuid"
+)
+
+const readUsage = "Usage: read <post id> | read --feed <feed> | read --before <date>"
+
+// handlerRead marks a post as read, or in bulk every post of a feed or
+// every followed post published before a date.
+func handlerRead(s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	feedRef := fs.String("feed", "", "mark every post of this feed (URL or name) as read")
+	before := fs.String("before", "", "mark followed posts published before this date (YYYY-MM-DD or RFC 3339) as read")
+	args, err := parseFlags(fs, cmd.Args)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	switch {
+	case *feedRef != "" && *before == "" && len(args) == 0:
+		feed, err := lookupFeed(ctx, s, *feedRef)
+		if err != nil {
+			return err
+		}
+		marked, err := s.db.MarkFeedRead(ctx, database.MarkFeedReadParams{UserID: user.ID, ReadAt: now, FeedID: nullFeedID(feed.ID)})
+		if err != nil {
+			return fmt.Errorf("Could not mark posts of %v as read: %v", feed.Name, err)
+		}
+		fmt.Printf("Marked %v posts of %v as read\n", marked, feed.Name)
+		return nil
+	case *before != "" && *feedRef == "" && len(args) == 0:
+		date, err := parseDateArg(*before)
+		if err != nil {
+			return err
+		}
+		marked, err := s.db.MarkPostsReadBefore(ctx, database.MarkPostsReadBeforeParams{ReadAt: now, UserID: user.ID, Before: date})
+		if err != nil {
+			return fmt.Errorf("Could not mark posts before %v as read: %v", *before, err)
+		}
+		fmt.Printf("Marked %v posts published before %v as read\n", marked, date.Format(time.RFC3339))
+		return nil
+	case *feedRef == "" && *before == "" && len(args) == 1:
+		postID, err := uuid.Parse(args[0])
+		if err != nil {
+			return fmt.Errorf("Invalid post id %v: %v", args[0], err)
+		}
+		marked, err := s.db.MarkPostRead(ctx, database.MarkPostReadParams{UserID: user.ID, ReadAt: now, PostID: postID})
+		if err != nil {
+			return fmt.Errorf("Could not mark post %v as read: %v", postID, err)
+		}
+		if marked == 0 {
+			return fmt.Errorf("No post with id %v", postID)
+		}
+		fmt.Printf("Marked post %v as read\n", postID)
+		return nil
+	}
+	return errors.New(readUsage)
+}
+
+func handlerUnread(s *state, cmd command, user database.User) error {
+	if len(cmd.Args) != 1 {
+		return errors.New("Usage: unread <post id>")
+	}
+	postID, err := uuid.Parse(cmd.Args[0])
+	if err != nil {
+		return fmt.Errorf("Invalid post id %v: %v", cmd.Args[0], err)
+	}
+	marked, err := s.db.MarkPostUnread(context.Background(), database.MarkPostUnreadParams{UserID: user.ID, PostID: postID})
+	if err != nil {
+		return fmt.Errorf("Could not mark post %v as unread: %v", postID, err)
+	}
+	if marked == 0 {
+		return fmt.Errorf("No read post with id %v", postID)
+	}
+	fmt.Printf("Marked post %v as unread\n", postID)
+	return nil
+}
+
+// parseDateArg accepts a local calendar date or an RFC 3339 timestamp and
+// returns it in UTC, as post times are stored.
+func parseDateArg(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid date %v, expected YYYY-MM-DD or RFC 3339", value)
+	}
+	return t.UTC(), nil
+}
+
+func handlerStar(s *state, cmd command, user database.User) error {
+	if len(cmd.Args) != 1 {
+		return errors.New("Usage: star <post id>")
+	}
+	postID, err := uuid.Parse(cmd.Args[0])
+	if err != nil {
+		return fmt.Errorf("Invalid post id %v: %v", cmd.Args[0], err)
+	}
+	starred, err := s.db.StarPost(context.Background(), database.StarPostParams{
+		UserID:    user.ID,
+		StarredAt: time.Now().UTC(),
+		PostID:    postID,
+	})
+	if err != nil {
+		return fmt.Errorf("Could not star post %v: %v", postID, err)
+	}
+	if starred == 0 {
+		return fmt.Errorf("No post with id %v", postID)
+	}
+	fmt.Printf("Starred post %v\n", postID)
+	return nil
+}
+
+// handlerUnstar removes a star, deleting the post if it was only kept
+// because it was starred.
+func handlerUnstar(s *state, cmd command, user database.User) error {
+	if len(cmd.Args) != 1 {
+		return errors.New("Usage: unstar <post id>")
+	}
+	postID, err := uuid.Parse(cmd.Args[0])
+	if err != nil {
+		return fmt.Errorf("Invalid post id %v: %v", cmd.Args[0], err)
+	}
+	ctx := context.Background()
+	err = s.db.UnstarPost(ctx, database.UnstarPostParams{UserID: user.ID, PostID: postID})
+	if err != nil {
+		return fmt.Errorf("Could not unstar post %v: %v", postID, err)
+	}
+	fmt.Printf("Unstarred post %v\n", postID)
+	if deleted, err := s.db.DeleteOrphanedPosts(ctx); err != nil {
+		return fmt.Errorf("Could not delete posts of deleted feeds: %v", err)
+	} else if deleted > 0 {
+		fmt.Printf("Deleted %v posts whose feed no longer exists\n", deleted)
+	}
+	return nil
+}
+
+func handlerStarred(s *state, cmd command, user database.User) error {
+	if len(cmd.Args) != 0 {
+		return fmt.Errorf("Unexpected arguments: %v", cmd.Args)
+	}
+	posts, err := s.db.GetStarredPosts(context.Background(), user.ID)
+	if err != nil {
+		return fmt.Errorf("Could not get starred posts: %v", err)
+	}
+	fmt.Printf("Found %d starred posts for user %s:\n", len(posts), user.Name)
+	for _, post := range posts {
+		feedName := post.FeedName.String
+		if !post.FeedName.Valid {
+			feedName = "a deleted feed"
+		}
+		fmt.Printf("%s from %s, starred %s\n", post.PublishedAt.Format("Mon Jan 2"), feedName, post.StarredAt.Time.Format("Mon Jan 2"))
+		fmt.Printf("--- %s ---\n", post.Title)
+		fmt.Printf("Link: %s\n", post.Url)
+		fmt.Printf("Post ID: %s\n", post.ID)
+		fmt.Println("=====================================")
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultFetchInterval is used until a feed has enough dated posts to
+	// estimate how often it publishes.
+	defaultFetchInterval = time.Hour
+	// recentPostSample is how many recent posts the frequency estimate uses.
+	recentPostSample = 20
+)
+
+// fetchHints are the publisher's own caching and scheduling hints from the
+// last response.
+type fetchHints struct {
+	TTL        time.Duration
+	MaxAge     time.Duration
+	RetryAfter time.Duration
+	SkipHours  map[int]bool
+	SkipDays   map[time.Weekday]bool
+}
+
+// nextFetchAt schedules a feed's next poll. The base interval is half the
+// median gap between its recent posts, raised to honor <ttl> and
+// Cache-Control and clamped to [minInterval, maxInterval]. Retry-After is
+// honored even beyond maxInterval, and the result is pushed past any
+// <skipHours>/<skipDays>.
+func nextFetchAt(now time.Time, postTimes []time.Time, hints fetchHints, minInterval, maxInterval time.Duration) time.Time {
+	interval := defaultFetchInterval
+	if len(postTimes) >= 2 {
+		interval = postingInterval(postTimes) / 2
+	}
+	interval = max(interval, hints.TTL, hints.MaxAge)
+	interval = min(max(interval, minInterval), maxInterval)
+	interval = max(interval, hints.RetryAfter)
+
+	next := now.Add(interval)
+	// A week of hours covers every skipHours/skipDays combination.
+	for i := 0; i < 24*7 && hints.skips(next); i++ {
+		next = next.Truncate(time.Hour).Add(time.Hour)
+	}
+	return next
+}
+
+func (h fetchHints) skips(t time.Time) bool {
+	t = t.UTC()
+	return h.SkipHours[t.Hour()] || h.SkipDays[t.Weekday()]
+}
+
+// postingInterval returns the median gap between posts, which a single
+// burst or a long hiatus skews less than the mean would.
+func postingInterval(postTimes []time.Time) time.Duration {
+	sorted := append([]time.Time(nil), postTimes...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Before(sorted[j]) })
+	gaps := make([]time.Duration, 0, len(sorted)-1)
+	for i := 1; i < len(sorted); i++ {
+		gaps = append(gaps, sorted[i].Sub(sorted[i-1]))
+	}
+	sort.Slice(gaps, func(i, j int) bool { return gaps[i] < gaps[j] })
+	return gaps[len(gaps)/2]
+}
+
+// feedHints reads <ttl>, <skipHours> and <skipDays> from an RSS channel.
+func feedHints(feed *RSSFeed) fetchHints {
+	var hints fetchHints
+	if feed == nil {
+		return hints
+	}
+	if ttl, err := strconv.Atoi(strings.TrimSpace(feed.Channel.TTL)); err == nil && ttl > 0 {
+		hints.TTL = time.Duration(ttl) * time.Minute
+	}
+	for _, hour := range feed.Channel.SkipHours {
+		if h, err := strconv.Atoi(strings.TrimSpace(hour)); err == nil && h >= 0 && h < 24 {
+			if hints.SkipHours == nil {
+				hints.SkipHours = map[int]bool{}
+			}
+			hints.SkipHours[h] = true
+		}
+	}
+	for _, day := range feed.Channel.SkipDays {
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			if strings.EqualFold(strings.TrimSpace(day), d.String()) {
+				if hints.SkipDays == nil {
+					hints.SkipDays = map[time.Weekday]bool{}
+				}
+				hints.SkipDays[d] = true
+			}
+		}
+	}
+	// A feed that skips every hour or every day would never be polled.
+	if len(hints.SkipHours) == 24 {
+		hints.SkipHours = nil
+	}
+	if len(hints.SkipDays) == 7 {
+		hints.SkipDays = nil
+	}
+	return hints
+}
+
+// cacheMaxAge returns the Cache-Control max-age (or s-maxage) of a response.
+func cacheMaxAge(header http.Header) time.Duration {
+	var maxAge time.Duration
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(directive), "=")
+		if !ok {
+			continue
+		}
+		name = strings.ToLower(name)
+		if name != "max-age" && name != "s-maxage" {
+			continue
+		}
+		if seconds, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil && seconds > 0 {
+			maxAge = max(maxAge, time.Duration(seconds)*time.Second)
+		}
+	}
+	return maxAge
+}
+
+// retryAfter parses a Retry-After header given either in seconds or as an
+// HTTP date.
+func retryAfter(header http.Header, now time.Time) time.Duration {
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNextFetchAt(t *testing.T) {
+	// A Monday.
+	now := time.Date(2024, 3, 4, 10, 30, 0, 0, time.UTC)
+	every := func(gap time.Duration) []time.Time {
+		return []time.Time{now.Add(-3 * gap), now.Add(-2 * gap), now.Add(-gap)}
+	}
+	allHours := map[int]bool{}
+	for h := 0; h < 24; h++ {
+		allHours[h] = true
+	}
+	const minInterval, maxInterval = 15 * time.Minute, 24 * time.Hour
+	tests := []struct {
+		name      string
+		postTimes []time.Time
+		hints     fetchHints
+		want      time.Time
+	}{
+		{"no posts", nil, fetchHints{}, now.Add(defaultFetchInterval)},
+		{"one post", every(time.Hour)[:1], fetchHints{}, now.Add(defaultFetchInterval)},
+		{"half the posting interval", every(4 * time.Hour), fetchHints{}, now.Add(2 * time.Hour)},
+		{"clamped to min", every(10 * time.Minute), fetchHints{}, now.Add(minInterval)},
+		{"clamped to max", every(7 * 24 * time.Hour), fetchHints{}, now.Add(maxInterval)},
+		{"ttl raises interval", every(10 * time.Minute), fetchHints{TTL: 3 * time.Hour}, now.Add(3 * time.Hour)},
+		{"max-age raises interval", nil, fetchHints{MaxAge: 2 * time.Hour}, now.Add(2 * time.Hour)},
+		{"ttl clamped to max", nil, fetchHints{TTL: 48 * time.Hour}, now.Add(maxInterval)},
+		{"retry-after past max", nil, fetchHints{RetryAfter: 36 * time.Hour}, now.Add(36 * time.Hour)},
+		{
+			"skip hours",
+			nil,
+			fetchHints{SkipHours: map[int]bool{11: true, 12: true}},
+			time.Date(2024, 3, 4, 13, 0, 0, 0, time.UTC),
+		},
+		{
+			"skip days",
+			nil,
+			fetchHints{SkipDays: map[time.Weekday]bool{time.Monday: true}},
+			time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			"skip hours and days",
+			nil,
+			fetchHints{SkipHours: map[int]bool{0: true}, SkipDays: map[time.Weekday]bool{time.Monday: true}},
+			time.Date(2024, 3, 5, 1, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := nextFetchAt(now, tt.postTimes, tt.hints, minInterval, maxInterval)
+			if !got.Equal(tt.want) {
+				t.Errorf("nextFetchAt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("every hour skipped", func(t *testing.T) {
+		got := nextFetchAt(now, nil, fetchHints{SkipHours: allHours}, minInterval, maxInterval)
+		if latest := now.Add(defaultFetchInterval + 7*24*time.Hour); got.After(latest) {
+			t.Errorf("nextFetchAt() = %v, want no later than %v", got, latest)
+		}
+	})
+}
+
+func TestFeedHints(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want fetchHints
+	}{
+		{
+			name: "ttl, skipHours and skipDays",
+			body: `<rss version="2.0"><channel><title>T</title><ttl> 90 </ttl>
+<skipHours><hour>0</hour><hour>23</hour><hour>24</hour><hour>noon</hour></skipHours>
+<skipDays><day>saturday</day><day> Sunday </day><day>Funday</day></skipDays>
+</channel></rss>`,
+			want: fetchHints{
+				TTL:       90 * time.Minute,
+				SkipHours: map[int]bool{0: true, 23: true},
+				SkipDays:  map[time.Weekday]bool{time.Saturday: true, time.Sunday: true},
+			},
+		},
+		{
+			name: "invalid ttl",
+			body: `<rss version="2.0"><channel><title>T</title><ttl>-5</ttl></channel></rss>`,
+			want: fetchHints{},
+		},
+		{
+			name: "every hour and day skipped",
+			body: `<rss version="2.0"><channel><title>T</title><skipHours>` +
+				`<hour>0</hour><hour>1</hour><hour>2</hour><hour>3</hour><hour>4</hour><hour>5</hour>` +
+				`<hour>6</hour><hour>7</hour><hour>8</hour><hour>9</hour><hour>10</hour><hour>11</hour>` +
+				`<hour>12</hour><hour>13</hour><hour>14</hour><hour>15</hour><hour>16</hour><hour>17</hour>` +
+				`<hour>18</hour><hour>19</hour><hour>20</hour><hour>21</hour><hour>22</hour><hour>23</hour>` +
+				`</skipHours><skipDays><day>Monday</day><day>Tuesday</day><day>Wednesday</day>` +
+				`<day>Thursday</day><day>Friday</day><day>Saturday</day><day>Sunday</day></skipDays>` +
+				`</channel></rss>`,
+			want: fetchHints{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feed, err := parseFeed([]byte(tt.body), "application/rss+xml")
+			if err != nil {
+				t.Fatalf("parseFeed: %v", err)
+			}
+			if got := feedHints(feed); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("feedHints() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if got := feedHints(nil); !reflect.DeepEqual(got, fetchHints{}) {
+		t.Errorf("feedHints(nil) = %+v, want no hints", got)
+	}
+}
+
+func TestCacheMaxAge(t *testing.T) {
+	tests := []struct {
+		cacheControl string
+		want         time.Duration
+	}{
+		{"", 0},
+		{"no-cache", 0},
+		{"max-age=300", 5 * time.Minute},
+		{"Max-Age=30", 30 * time.Second},
+		{`max-age="120"`, 2 * time.Minute},
+		{"public, s-maxage=600, max-age=60", 10 * time.Minute},
+		{"max-age=-1", 0},
+		{"max-age=soon", 0},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.cacheControl != "" {
+			header.Set("Cache-Control", tt.cacheControl)
+		}
+		if got := cacheMaxAge(header); got != tt.want {
+			t.Errorf("cacheMaxAge(%q) = %v, want %v", tt.cacheControl, got, tt.want)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 3, 4, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{" 30 ", 30 * time.Second},
+		{"0", 0},
+		{"soon", 0},
+		{now.Add(time.Hour).Format(http.TimeFormat), time.Hour},
+		{now.Add(-time.Hour).Format(http.TimeFormat), 0},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.value != "" {
+			header.Set("Retry-After", tt.value)
+		}
+		if got := retryAfter(header, now); got != tt.want {
+			t.Errorf("retryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+-- name: UpsertEnclosure :exec
+INSERT INTO enclosures (id, created_at, post_id, url, mime_type, length, duration_seconds)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (post_id, url) DO UPDATE
+SET mime_type = EXCLUDED.mime_type,
+    length = EXCLUDED.length,
+    duration_seconds = EXCLUDED.duration_seconds;
+
+-- name: GetEnclosuresForPosts :many
+SELECT * FROM enclosures
+WHERE post_id = ANY(sqlc.arg(post_ids)::UUID[])
+ORDER BY post_id, created_at, url;
+
+-- name: GetPostEnclosures :many
+-- feed_name is NULL for starred posts kept after their feed was removed.
+SELECT enclosures.*, feeds.name AS feed_name FROM enclosures
+JOIN posts ON posts.id = enclosures.post_id
+LEFT JOIN feeds ON feeds.id = posts.feed_id
+WHERE enclosures.post_id = $1
+ORDER BY enclosures.created_at, enclosures.url;
@@ -1,22 +1,34 @@
 -- name: CreateFeed :one
-INSERT INTO feeds (id, created_at, updated_at, name, url, user_id)
+INSERT INTO feeds (id, created_at, updated_at, name, url, user_id, canonical_url)
 VALUES (
     $1,
     $2,
     $3,
     $4,
     $5,
-    $6
+    $6,
+    $7
 )
 RETURNING *;
 
--- name: GetFeedByName :one
+-- name: GetFeedsByName :many
+-- Names aren't unique, so this can return several feeds.
 SELECT * FROM feeds
-WHERE name = $1;
+WHERE name = $1
+ORDER BY created_at;
 
--- name: GetFeedByURL :one
+-- name: GetFeedsByURL :many
+-- Matches the feed's current URL as given or normalized, its canonical form
+-- or any URL it has moved away from. Until dedupe has run these can match
+-- more than one feed.
 SELECT * FROM feeds
-WHERE url = $1;
+WHERE url IN (sqlc.arg(url), sqlc.arg(raw_url))
+    OR canonical_url = sqlc.arg(canonical_url)
+    OR id IN (
+        SELECT feed_id FROM feed_url_aliases
+        WHERE feed_url_aliases.url IN (sqlc.arg(url), sqlc.arg(raw_url))
+    )
+ORDER BY created_at;
 
 -- name: GetFeeds :many
 SELECT * FROM feeds;
@@ -24,13 +36,152 @@ SELECT * FROM feeds;
 -- name: DeleteFeeds :exec
 DELETE FROM feeds;
 
--- name: MarkFeedFetched :exec
+-- name: DeleteFeed :exec
+DELETE FROM feeds
+WHERE id = $1;
+
+-- name: ClaimNextFeedToFetch :one
+-- The provisional next_fetch_at leases the feed to the claiming worker
+-- until SetFeedNextFetch records the real schedule. now is the caller's UTC
+-- time, the clock SetFeedNextFetch's schedule is written in, rather than
+-- NOW() in the session's time zone.
+UPDATE feeds
+SET updated_at = sqlc.arg(now)::TIMESTAMP,
+    last_fetched_at = sqlc.arg(now)::TIMESTAMP,
+    next_fetch_at = sqlc.arg(now)::TIMESTAMP + INTERVAL '10 minutes'
+WHERE id = (
+    SELECT id FROM feeds
+    WHERE disabled_at IS NULL
+        AND (next_fetch_at IS NULL OR next_fetch_at <= sqlc.arg(now)::TIMESTAMP)
+    ORDER BY next_fetch_at ASC NULLS FIRST, last_fetched_at ASC NULLS FIRST
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: SetFeedCacheHeaders :exec
+UPDATE feeds
+SET etag = $2,
+    last_modified = $3
+WHERE id = $1;
+
+-- name: SetFeedNextFetch :exec
+UPDATE feeds
+SET next_fetch_at = $2
+WHERE id = $1;
+
+-- name: RecordFeedSuccess :exec
+UPDATE feeds
+SET last_status = $2,
+    last_error = NULL,
+    consecutive_failures = 0,
+    last_success_at = NOW()
+WHERE id = $1;
+
+-- name: RecordFeedFailure :one
+UPDATE feeds
+SET last_status = $2,
+    last_error = $3,
+    consecutive_failures = consecutive_failures + 1
+WHERE id = $1
+RETURNING consecutive_failures;
+
+-- name: DisableFeed :exec
 UPDATE feeds
-SET updated_at = NOW(),
-    last_fetched_at = NOW()
+SET disabled_at = NOW()
 WHERE id = $1;
 
--- name: GetNextFeedToFetch :one
+-- name: EnableFeed :exec
+UPDATE feeds
+SET disabled_at = NULL,
+    consecutive_failures = 0,
+    next_fetch_at = NULL
+WHERE id = $1;
+
+-- name: GetUnhealthyFeeds :many
 SELECT * FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT 1;
+WHERE consecutive_failures > 0 OR disabled_at IS NOT NULL
+ORDER BY disabled_at ASC NULLS LAST, consecutive_failures DESC;
+
+-- name: RecordFeedRedirect :one
+UPDATE feeds
+SET redirect_count = CASE WHEN redirect_url = $2 THEN redirect_count + 1 ELSE 1 END,
+    redirect_url = $2
+WHERE id = $1
+RETURNING redirect_count;
+
+-- name: ClearFeedRedirect :exec
+UPDATE feeds
+SET redirect_url = NULL,
+    redirect_count = 0
+WHERE id = $1;
+
+-- name: MoveFeedURL :exec
+-- The old URL is kept as an alias so lookups by it still find the feed.
+WITH old_url AS (
+    INSERT INTO feed_url_aliases (url, feed_id, created_at)
+    SELECT url, id, NOW() FROM feeds WHERE id = $1
+    ON CONFLICT (url) DO NOTHING
+), new_url AS (
+    DELETE FROM feed_url_aliases
+    WHERE feed_url_aliases.url = $2 AND feed_id = $1
+)
+UPDATE feeds
+SET url = $2,
+    canonical_url = $3,
+    updated_at = NOW(),
+    redirect_url = NULL,
+    redirect_count = 0
+WHERE id = $1;
+
+-- name: SetFeedURL :exec
+UPDATE feeds
+SET url = $2,
+    canonical_url = $3,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: MergeFeedAliases :exec
+-- Hands the source feed's aliases to the target and adds url, the source's
+-- own URL, as another.
+WITH moved AS (
+    UPDATE feed_url_aliases
+    SET feed_id = sqlc.arg(to_feed_id)
+    WHERE feed_id = sqlc.arg(from_feed_id)
+)
+INSERT INTO feed_url_aliases (url, feed_id, created_at)
+VALUES (sqlc.arg(url), sqlc.arg(to_feed_id), NOW())
+ON CONFLICT (url) DO NOTHING;
+
+-- name: RenameFeed :exec
+UPDATE feeds
+SET name = $2,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: ChangeFeedURL :exec
+-- Forgets everything learned from fetching the old URL, so the feed is
+-- fetched afresh on the next aggregator pass.
+UPDATE feeds
+SET url = $2,
+    canonical_url = $3,
+    updated_at = NOW(),
+    etag = NULL,
+    last_modified = NULL,
+    next_fetch_at = NULL,
+    last_status = NULL,
+    last_error = NULL,
+    consecutive_failures = 0,
+    disabled_at = NULL,
+    redirect_url = NULL,
+    redirect_count = 0
+WHERE id = $1;
+
+-- name: SetFeedMetadata :exec
+UPDATE feeds
+SET site_url = $2,
+    description = $3,
+    language = $4,
+    image_url = $5,
+    generator = $6
+WHERE id = $1;
@@ -40,3 +40,16 @@ ON users.id = selected_feed_follows.user_id
 -- name: DeleteFeedFollowForUser :exec
 DELETE FROM feed_follows
 WHERE feed_id = $2 AND user_id = $1;
+
+-- name: MoveFeedFollows :exec
+-- Users already following the target feed keep that follow; their follow
+-- of the source feed is left to be deleted with it.
+UPDATE feed_follows
+SET feed_id = sqlc.arg(to_feed_id),
+    updated_at = NOW()
+WHERE feed_id = sqlc.arg(from_feed_id)
+    AND user_id NOT IN (SELECT user_id FROM feed_follows WHERE feed_id = sqlc.arg(to_feed_id));
+
+-- name: CountFeedFollows :one
+SELECT COUNT(*) FROM feed_follows
+WHERE feed_id = $1;
@@ -1,15 +1,130 @@
--- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+-- name: UpsertPost :one
+-- Returns no row when the post is already stored unchanged, so refetching a
+-- feed doesn't rewrite every post in it.
+INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id, published_at_source, guid, author, categories, content, comments_url)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+ON CONFLICT (feed_id, guid) DO UPDATE
+SET title = EXCLUDED.title,
+    url = EXCLUDED.url,
+    description = EXCLUDED.description,
+    author = EXCLUDED.author,
+    categories = EXCLUDED.categories,
+    content = EXCLUDED.content,
+    comments_url = EXCLUDED.comments_url,
+    updated_at = CASE
+        WHEN posts.title IS DISTINCT FROM EXCLUDED.title
+            OR posts.url IS DISTINCT FROM EXCLUDED.url
+            OR posts.description IS DISTINCT FROM EXCLUDED.description
+            OR posts.content IS DISTINCT FROM EXCLUDED.content
+        THEN EXCLUDED.updated_at
+        ELSE posts.updated_at
+    END
+WHERE (posts.title, posts.url, posts.description, posts.author, posts.categories, posts.content, posts.comments_url)
+    IS DISTINCT FROM (EXCLUDED.title, EXCLUDED.url, EXCLUDED.description, EXCLUDED.author, EXCLUDED.categories, EXCLUDED.content, EXCLUDED.comments_url)
 RETURNING *;
 --
 
 -- name: GetPostsForUser :many
-SELECT posts.*, feeds.name AS feed_name FROM posts
+-- Every filter is skipped when its argument is NULL. Pages either by offset
+-- or, stably while new posts arrive, by a keyset cursor: the sort key and id
+-- of the last post already seen. Sorting by feed name only supports offsets.
+SELECT posts.*, feeds.name AS feed_name, COALESCE(user_post_states.read, FALSE) AS read, user_post_states.starred_at IS NOT NULL AS starred FROM posts
 JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
 JOIN feeds ON posts.feed_id = feeds.id
-WHERE feed_follows.user_id = $1
-ORDER BY posts.published_at DESC
-LIMIT $2;
+LEFT JOIN user_post_states ON user_post_states.post_id = posts.id
+    AND user_post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+    AND (sqlc.arg(read_state)::TEXT = 'all' OR COALESCE(user_post_states.read, FALSE) = (sqlc.arg(read_state)::TEXT = 'read'))
+    AND (sqlc.narg(feed_id)::UUID IS NULL OR posts.feed_id = sqlc.narg(feed_id))
+    AND (sqlc.narg(since)::TIMESTAMP IS NULL OR posts.published_at >= sqlc.narg(since))
+    AND (sqlc.narg(until)::TIMESTAMP IS NULL OR posts.published_at < sqlc.narg(until))
+    AND (
+        sqlc.narg(keyword)::TEXT IS NULL
+        OR posts.title ILIKE '%' || sqlc.narg(keyword) || '%'
+        OR posts.description ILIKE '%' || sqlc.narg(keyword) || '%'
+    )
+    AND (sqlc.narg(author)::TEXT IS NULL OR posts.author ILIKE '%' || sqlc.narg(author) || '%')
+    AND (
+        sqlc.narg(cursor_sort_key)::TIMESTAMP IS NULL
+        OR (
+            sqlc.arg(sort_desc)::BOOLEAN
+            AND (CASE WHEN sqlc.arg(sort_by)::TEXT = 'fetched' THEN posts.created_at ELSE posts.published_at END, posts.id)
+                < (sqlc.narg(cursor_sort_key), sqlc.narg(cursor_id)::UUID)
+        )
+        OR (
+            NOT sqlc.arg(sort_desc)::BOOLEAN
+            AND (CASE WHEN sqlc.arg(sort_by)::TEXT = 'fetched' THEN posts.created_at ELSE posts.published_at END, posts.id)
+                > (sqlc.narg(cursor_sort_key), sqlc.narg(cursor_id)::UUID)
+        )
+    )
+ORDER BY
+    CASE WHEN sqlc.arg(sort_by)::TEXT = 'feed' AND NOT sqlc.arg(sort_desc)::BOOLEAN THEN feeds.name END ASC,
+    CASE WHEN sqlc.arg(sort_by)::TEXT = 'feed' AND sqlc.arg(sort_desc)::BOOLEAN THEN feeds.name END DESC,
+    CASE WHEN sqlc.arg(sort_by)::TEXT <> 'feed' AND NOT sqlc.arg(sort_desc)::BOOLEAN
+        THEN CASE WHEN sqlc.arg(sort_by)::TEXT = 'fetched' THEN posts.created_at ELSE posts.published_at END
+    END ASC,
+    CASE WHEN sqlc.arg(sort_by)::TEXT <> 'feed' AND NOT sqlc.arg(sort_desc)::BOOLEAN THEN posts.id END ASC,
+    CASE WHEN sqlc.arg(sort_by)::TEXT = 'fetched' THEN posts.created_at ELSE posts.published_at END DESC,
+    posts.id DESC
+LIMIT sqlc.arg(post_limit)
+OFFSET sqlc.arg(post_offset);
 --
 
+-- name: GetRecentPostTimesForFeed :many
+SELECT published_at FROM posts
+WHERE feed_id = $1 AND published_at_source <> 'first_seen'
+ORDER BY published_at DESC
+LIMIT $2;
+
+-- name: MovePosts :exec
+-- Posts the target feed already has are left to be deleted with the source.
+UPDATE posts
+SET feed_id = sqlc.arg(to_feed_id)
+WHERE feed_id = sqlc.arg(from_feed_id)
+    AND guid NOT IN (SELECT guid FROM posts WHERE feed_id = sqlc.arg(to_feed_id));
+
+-- name: CountFeedPosts :one
+SELECT COUNT(*) FROM posts
+WHERE feed_id = $1;
+
+-- name: DeleteUnstarredFeedPosts :execrows
+-- Run before DeleteFeed, which keeps the starred posts without a feed.
+DELETE FROM posts
+WHERE feed_id = $1
+    AND NOT EXISTS (
+        SELECT 1 FROM user_post_states
+        WHERE user_post_states.post_id = posts.id AND user_post_states.starred_at IS NOT NULL
+    );
+
+-- name: DeleteOrphanedPosts :execrows
+-- Posts kept from a deleted feed go once nobody has them starred.
+DELETE FROM posts
+WHERE feed_id IS NULL
+    AND NOT EXISTS (
+        SELECT 1 FROM user_post_states
+        WHERE user_post_states.post_id = posts.id AND user_post_states.starred_at IS NOT NULL
+    );
+
+-- name: AdoptLegacyPost :one
+-- Posts stored before guids were tracked got a hash of their URL and title
+-- as guid. When an item with a real guid is first stored, the copy stored
+-- before gets that guid instead, so it is updated from then on.
+UPDATE posts
+SET guid = sqlc.arg(guid)
+WHERE id = (
+    SELECT legacy.id FROM posts AS legacy
+    WHERE legacy.feed_id = sqlc.arg(feed_id)
+        AND legacy.url IN (sqlc.arg(url), sqlc.arg(link))
+        AND legacy.guid = encode(sha256(convert_to(legacy.url || E'\n' || legacy.title, 'UTF8')), 'hex')
+    ORDER BY legacy.created_at
+    LIMIT 1
+)
+    AND NOT EXISTS (
+        SELECT 1 FROM posts AS existing
+        WHERE existing.feed_id = sqlc.arg(feed_id) AND existing.guid = sqlc.arg(guid)
+    )
+RETURNING *;
+
+-- name: DeletePost :exec
+DELETE FROM posts
+WHERE id = $1;
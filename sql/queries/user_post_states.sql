@@ -0,0 +1,62 @@
+-- name: MarkPostRead :execrows
+-- Affects no rows when the post doesn't exist.
+INSERT INTO user_post_states (user_id, post_id, read, read_at)
+SELECT sqlc.arg(user_id)::UUID, posts.id, TRUE, sqlc.arg(read_at)::TIMESTAMP
+FROM posts
+WHERE posts.id = sqlc.arg(post_id)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET read = TRUE,
+    read_at = COALESCE(user_post_states.read_at, EXCLUDED.read_at);
+
+-- name: MarkPostUnread :execrows
+-- Affects no rows unless the post was read.
+UPDATE user_post_states
+SET read = FALSE,
+    read_at = NULL
+WHERE user_id = $1 AND post_id = $2 AND read;
+
+-- name: MarkFeedRead :execrows
+-- Counts only the posts that were unread.
+INSERT INTO user_post_states (user_id, post_id, read, read_at)
+SELECT sqlc.arg(user_id)::UUID, posts.id, TRUE, sqlc.arg(read_at)::TIMESTAMP
+FROM posts
+WHERE posts.feed_id = sqlc.arg(feed_id)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET read = TRUE,
+    read_at = EXCLUDED.read_at
+WHERE NOT user_post_states.read;
+
+-- name: MarkPostsReadBefore :execrows
+-- Marks the user's followed posts published before the given time.
+INSERT INTO user_post_states (user_id, post_id, read, read_at)
+SELECT feed_follows.user_id, posts.id, TRUE, sqlc.arg(read_at)::TIMESTAMP
+FROM posts
+JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+    AND posts.published_at < sqlc.arg(before)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET read = TRUE,
+    read_at = EXCLUDED.read_at
+WHERE NOT user_post_states.read;
+
+-- name: StarPost :execrows
+-- Affects no rows when the post doesn't exist.
+INSERT INTO user_post_states (user_id, post_id, starred_at)
+SELECT sqlc.arg(user_id)::UUID, posts.id, sqlc.arg(starred_at)::TIMESTAMP
+FROM posts
+WHERE posts.id = sqlc.arg(post_id)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET starred_at = COALESCE(user_post_states.starred_at, EXCLUDED.starred_at);
+
+-- name: UnstarPost :exec
+UPDATE user_post_states
+SET starred_at = NULL
+WHERE user_id = $1 AND post_id = $2;
+
+-- name: GetStarredPosts :many
+-- Includes posts whose feed was unfollowed or deleted.
+SELECT posts.*, feeds.name AS feed_name, user_post_states.starred_at FROM user_post_states
+JOIN posts ON posts.id = user_post_states.post_id
+LEFT JOIN feeds ON feeds.id = posts.feed_id
+WHERE user_post_states.user_id = $1 AND user_post_states.starred_at IS NOT NULL
+ORDER BY user_post_states.starred_at DESC;
@@ -0,0 +1,19 @@
+-- +goose Up
+ALTER TABLE posts
+ADD COLUMN published_at_source TEXT NOT NULL DEFAULT 'published'
+;
+UPDATE posts
+SET published_at = created_at,
+    published_at_source = 'first_seen'
+WHERE published_at IS NULL
+;
+ALTER TABLE posts
+ALTER COLUMN published_at SET NOT NULL
+;
+-- +goose Down
+ALTER TABLE posts
+ALTER COLUMN published_at DROP NOT NULL
+;
+ALTER TABLE posts
+DROP COLUMN published_at_source
+;
@@ -0,0 +1,20 @@
+-- +goose Up
+ALTER TABLE posts
+ADD COLUMN guid TEXT
+;
+-- Matches itemGUID's fallback for items without a <guid>/<id>. Items that
+-- do have one are matched up with these rows by AdoptLegacyPost.
+UPDATE posts
+SET guid = encode(sha256(convert_to(url || E'\n' || title, 'UTF8')), 'hex')
+;
+ALTER TABLE posts
+ALTER COLUMN guid SET NOT NULL,
+DROP CONSTRAINT posts_url_key,
+ADD CONSTRAINT posts_feed_id_guid_key UNIQUE (feed_id, guid)
+;
+-- +goose Down
+ALTER TABLE posts
+DROP CONSTRAINT posts_feed_id_guid_key,
+ADD CONSTRAINT posts_url_key UNIQUE (url),
+DROP COLUMN guid
+;
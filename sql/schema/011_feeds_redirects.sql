@@ -0,0 +1,16 @@
+-- +goose Up
+ALTER TABLE feeds
+ADD COLUMN redirect_url TEXT,
+ADD COLUMN redirect_count INTEGER NOT NULL DEFAULT 0
+;
+CREATE TABLE feed_url_aliases (
+    url TEXT PRIMARY KEY,
+    feed_id UUID NOT NULL REFERENCES feeds(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL
+);
+-- +goose Down
+DROP TABLE feed_url_aliases;
+ALTER TABLE feeds
+DROP COLUMN redirect_url,
+DROP COLUMN redirect_count
+;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- user_id records who added the feed; everyone reading it, the creator
+-- included, is in feed_follows.
+ALTER TABLE feeds DROP CONSTRAINT feeds_user_id_key;
+CREATE INDEX feeds_user_id_idx ON feeds (user_id);
+-- +goose Down
+-- Fails if any user has added more than one feed.
+DROP INDEX feeds_user_id_idx;
+ALTER TABLE feeds ADD CONSTRAINT feeds_user_id_key UNIQUE (user_id);
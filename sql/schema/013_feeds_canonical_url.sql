@@ -0,0 +1,8 @@
+-- +goose Up
+-- Filled in for new feeds on insert and for existing ones by `gator dedupe`,
+-- which first merges any feeds that share one.
+ALTER TABLE feeds
+ADD COLUMN canonical_url TEXT UNIQUE
+;
+-- +goose Down
+ALTER TABLE feeds DROP COLUMN canonical_url;
@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE
+;
+-- The first user to register administers the instance.
+UPDATE users
+SET is_admin = TRUE
+WHERE id = (SELECT id FROM users ORDER BY created_at LIMIT 1)
+;
+-- +goose Down
+ALTER TABLE users DROP COLUMN is_admin;
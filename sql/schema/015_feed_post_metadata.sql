@@ -0,0 +1,28 @@
+-- +goose Up
+ALTER TABLE feeds
+ADD COLUMN site_url TEXT,
+ADD COLUMN description TEXT,
+ADD COLUMN language TEXT,
+ADD COLUMN image_url TEXT,
+ADD COLUMN generator TEXT
+;
+ALTER TABLE posts
+ADD COLUMN author TEXT,
+ADD COLUMN categories TEXT[] NOT NULL DEFAULT '{}',
+ADD COLUMN content TEXT,
+ADD COLUMN comments_url TEXT
+;
+-- +goose Down
+ALTER TABLE posts
+DROP COLUMN author,
+DROP COLUMN categories,
+DROP COLUMN content,
+DROP COLUMN comments_url
+;
+ALTER TABLE feeds
+DROP COLUMN site_url,
+DROP COLUMN description,
+DROP COLUMN language,
+DROP COLUMN image_url,
+DROP COLUMN generator
+;
@@ -0,0 +1,23 @@
+-- +goose Up
+ALTER TABLE user_post_states
+ADD COLUMN starred_at TIMESTAMP
+;
+-- Starred posts outlive their feed; the rest are deleted along with it by
+-- DeleteUnstarredFeedPosts.
+ALTER TABLE posts
+ALTER COLUMN feed_id DROP NOT NULL,
+DROP CONSTRAINT posts_feed_id_fkey,
+ADD CONSTRAINT posts_feed_id_fkey FOREIGN KEY (feed_id) REFERENCES feeds(id) ON DELETE SET NULL
+;
+-- +goose Down
+DELETE FROM posts
+WHERE feed_id IS NULL
+;
+ALTER TABLE posts
+DROP CONSTRAINT posts_feed_id_fkey,
+ADD CONSTRAINT posts_feed_id_fkey FOREIGN KEY (feed_id) REFERENCES feeds(id) ON DELETE CASCADE,
+ALTER COLUMN feed_id SET NOT NULL
+;
+ALTER TABLE user_post_states
+DROP COLUMN starred_at
+;
@@ -0,0 +1,5 @@
+-- +goose Up
+-- Lets AdoptLegacyPost find posts whose guid 008 derived from their URL.
+CREATE INDEX posts_feed_id_url_idx ON posts (feed_id, url);
+-- +goose Down
+DROP INDEX posts_feed_id_url_idx;
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/AkuPython/Gator/internal/database"
+)
+
+// trackingParams are query parameters that only identify where a link was
+// shared, never which resource it points at.
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"dclid":   true,
+	"msclkid": true,
+	"yclid":   true,
+	"igshid":  true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"_hsenc":  true,
+	"_hsmi":   true,
+}
+
+// normalizeURL cleans up a URL without changing what it fetches: the scheme
+// and host are lowercased and default ports, fragments and tracking
+// parameters dropped. Anything that isn't an absolute URL is returned as is.
+func normalizeURL(rawURL string) string {
+	rawURL = strings.TrimSpace(rawURL)
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	u.Host = host
+	if port != "" {
+		u.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		u.Host = "[" + host + "]"
+	}
+	u.Fragment, u.RawFragment = "", ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	// Filtered by hand rather than through url.Values so the remaining
+	// parameters keep their order and encoding.
+	var kept []string
+	for _, param := range strings.Split(u.RawQuery, "&") {
+		key, _, _ := strings.Cut(param, "=")
+		if key, err := url.QueryUnescape(key); err == nil && isTrackingParam(key) {
+			continue
+		}
+		if param != "" {
+			kept = append(kept, param)
+		}
+	}
+	u.RawQuery = strings.Join(kept, "&")
+	u.ForceQuery = false
+	return u.String()
+}
+
+func isTrackingParam(key string) bool {
+	key = strings.ToLower(key)
+	return strings.HasPrefix(key, "utm_") || trackingParams[key]
+}
+
+// canonicalURL is the key feeds are de-duplicated on: the normalized URL
+// without its scheme, trailing slash or query parameter order, so
+// http://x.com/feed and https://x.com/feed/ are the same feed.
+func canonicalURL(rawURL string) string {
+	normalized := normalizeURL(rawURL)
+	u, err := url.Parse(normalized)
+	if err != nil || u.Host == "" {
+		return normalized
+	}
+	key := u.Host + strings.TrimSuffix(u.EscapedPath(), "/")
+	if u.RawQuery != "" {
+		query, err := url.ParseQuery(u.RawQuery)
+		if err != nil {
+			return key + "?" + u.RawQuery
+		}
+		key += "?" + query.Encode()
+	}
+	return key
+}
+
+// getFeedByURL finds the feed for a URL as a user typed it, matching the
+// stored URL as typed or normalized, its canonical form or any URL the feed
+// has moved away from. Feeds added before URLs were normalized can match
+// more than once, which is an error rather than a guess.
+func getFeedByURL(ctx context.Context, s *state, rawURL string) (database.Feed, error) {
+	feeds, err := s.db.GetFeedsByURL(ctx, database.GetFeedsByURLParams{
+		Url:          normalizeURL(rawURL),
+		RawUrl:       rawURL,
+		CanonicalUrl: sql.NullString{String: canonicalURL(rawURL), Valid: true},
+	})
+	if err != nil {
+		return database.Feed{}, err
+	}
+	switch len(feeds) {
+	case 0:
+		return database.Feed{}, sql.ErrNoRows
+	case 1:
+		return feeds[0], nil
+	}
+	names := make([]string, len(feeds))
+	for i, feed := range feeds {
+		names[i] = fmt.Sprintf("%v (%v)", feed.Name, feed.Url)
+	}
+	return database.Feed{}, fmt.Errorf("URL %v matches several feeds, merge them with 'gator dedupe':\n\t%v", rawURL, strings.Join(names, "\n\t"))
+}
@@ -0,0 +1,55 @@
+package main
+
+import "testing"
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"https://example.com/feed", "https://example.com/feed"},
+		{"  HTTPS://Example.COM/Feed  ", "https://example.com/Feed"},
+		{"http://example.com:80/feed", "http://example.com/feed"},
+		{"https://example.com:443/feed", "https://example.com/feed"},
+		{"https://example.com:8443/feed", "https://example.com:8443/feed"},
+		{"http://[::1]:80/feed", "http://[::1]/feed"},
+		{"https://example.com", "https://example.com/"},
+		{"https://example.com/feed#latest", "https://example.com/feed"},
+		{"https://example.com/feed?", "https://example.com/feed"},
+		{"https://example.com/feed?utm_source=x&b=2&fbclid=y&a=1", "https://example.com/feed?b=2&a=1"},
+		{"https://example.com/feed?UTM_Medium=x", "https://example.com/feed"},
+		{"https://example.com/feed?q=a%20b&gclid=1", "https://example.com/feed?q=a%20b"},
+		{"example.com/feed", "example.com/feed"},
+		{"not a url", "not a url"},
+	}
+	for _, tt := range tests {
+		if got := normalizeURL(tt.in); got != tt.want {
+			t.Errorf("normalizeURL(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCanonicalURL(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"https://example.com/feed", "example.com/feed"},
+		{"http://Example.com/feed/", "example.com/feed"},
+		{"https://example.com:443/feed/#top", "example.com/feed"},
+		{"https://example.com", "example.com"},
+		{"https://example.com/feed?b=2&a=1", "example.com/feed?a=1&b=2"},
+		{"https://example.com/feed?utm_campaign=x", "example.com/feed"},
+		{"https://example.com:8080/feed", "example.com:8080/feed"},
+		{"not a url", "not a url"},
+	}
+	for _, tt := range tests {
+		if got := canonicalURL(tt.in); got != tt.want {
+			t.Errorf("canonicalURL(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	if canonicalURL("http://example.com/feed") != canonicalURL("https://EXAMPLE.com:443/feed/?utm_source=rss") {
+		t.Error("equivalent URLs have different canonical forms")
+	}
+}